@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// Answer is a typed answer for programmatic consumers: the text shown to the user, the
+// schedule sections it is based on, and what the model made of the question.
+type Answer struct {
+	Text       string   `json:"text"`
+	Sections   []Course `json:"sections"`   // Sections the answer cites, as in the schedule
+	FollowUps  []string `json:"follow_ups"` // Questions the user might ask next
+	Confidence float64  `json:"confidence"` // From 0 to 1, as judged by the model
+	Intent     string   `json:"intent"`     // One of the intent constants
+}
+
+// What a question asks about.
+const (
+	intentCourse        = "course"        // Which courses or sections are offered, and their details
+	intentInstructor    = "instructor"    // Who teaches what, or how to reach them
+	intentSchedule      = "schedule"      // When or where classes meet
+	intentRoom          = "room"          // Room occupancy or free rooms
+	intentPrerequisites = "prerequisites" // Prerequisites and catalog descriptions
+	intentWebPage       = "web_page"      // Finding a university web page
+	intentOther         = "other"
+)
+
+var intents = []string{intentCourse, intentInstructor, intentSchedule, intentRoom, intentPrerequisites, intentWebPage, intentOther}
+
+// maxFollowUps limits the follow-up questions suggested with an answer.
+const maxFollowUps = 3
+
+// answerSchema is the JSON schema the model's structured replies follow. Sections are
+// cited by CRN and looked up in the schedule, so an answer never returns a section
+// the schedule does not have.
+var answerSchema = jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"text": {
+			Type:        jsonschema.String,
+			Description: "The answer to show the user.",
+		},
+		"cited_crns": {
+			Type:        jsonschema.Array,
+			Items:       &jsonschema.Definition{Type: jsonschema.String},
+			Description: "CRNs of the schedule sections the answer is based on.",
+		},
+		"follow_ups": {
+			Type:        jsonschema.Array,
+			Items:       &jsonschema.Definition{Type: jsonschema.String},
+			Description: fmt.Sprintf("Up to %d short questions the user might ask next.", maxFollowUps),
+		},
+		"confidence": {
+			Type:        jsonschema.Number,
+			Description: "How sure you are that the answer is correct and complete, from 0 to 1.",
+		},
+		"intent": {
+			Type:        jsonschema.String,
+			Enum:        intents,
+			Description: "What the user's question asks about.",
+		},
+	},
+	Required:             []string{"text", "cited_crns", "follow_ups", "confidence", "intent"},
+	AdditionalProperties: false,
+}
+
+// answerFormat asks the model to reply following answerSchema.
+var answerFormat = &openai.ChatCompletionResponseFormat{
+	Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+	JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+		Name:        "course_answer",
+		Description: "An answer to a question about the course schedule.",
+		Schema:      &answerSchema,
+		Strict:      true,
+	},
+}
+
+// structuredReply is a reply following answerSchema.
+type structuredReply struct {
+	Text       string   `json:"text"`
+	CitedCRNs  []string `json:"cited_crns"`
+	FollowUps  []string `json:"follow_ups"`
+	Confidence float64  `json:"confidence"`
+	Intent     string   `json:"intent"`
+}
+
+// structuredAnswerKey carries the *Answer a structured question fills in.
+type structuredAnswerKey struct{}
+
+// withStructuredAnswer returns a context under which the model is asked for a
+// structured reply, and the answer that answering the question fills in.
+func withStructuredAnswer(ctx context.Context) (context.Context, *Answer) {
+	answer := &Answer{}
+	return context.WithValue(ctx, structuredAnswerKey{}, answer), answer
+}
+
+// structuredAnswerFrom returns the answer to fill in for ctx, or nil if the question
+// is answered with free text.
+func structuredAnswerFrom(ctx context.Context) *Answer {
+	answer, _ := ctx.Value(structuredAnswerKey{}).(*Answer)
+	return answer
+}
+
+// AnswerStructured answers a question like Answer, asking the model for a typed
+// Answer instead of free text.
+func (bot *ChatBot) AnswerStructured(ctx context.Context, session *Session, question string) (*Answer, error) {
+	ctx, answer := withStructuredAnswer(ctx)
+	text, err := bot.Answer(ctx, session, question)
+	if err != nil {
+		return nil, err
+	}
+	if answer.Intent == "" {
+		// Replies given without asking the model, such as clarifying questions
+		*answer = Answer{Text: text, Confidence: 1, Intent: intentOther}
+	}
+	// Consumers get empty lists rather than null
+	if answer.Sections == nil {
+		answer.Sections = []Course{}
+	}
+	if answer.FollowUps == nil {
+		answer.FollowUps = []string{}
+	}
+	answerDetailsFrom(ctx).setIntent(answer.Intent)
+	return answer, nil
+}
+
+// AnswerQuestionStructured answers a question in the chatbot's own conversation with a
+// typed Answer.
+func (bot *ChatBot) AnswerQuestionStructured(ctx context.Context, question string) (*Answer, error) {
+	return bot.AnswerStructured(ctx, bot.session, question)
+}
+
+// cannedAnswer fills in the structured answer, if one was asked for, with a reply given
+// without asking the model.
+func cannedAnswer(ctx context.Context, text, intent string) {
+	if answer := structuredAnswerFrom(ctx); answer != nil {
+		*answer = Answer{Text: text, Confidence: 1, Intent: intent}
+	}
+}
+
+// answerCacheMode keeps typed and free text answers apart in the answer cache.
+func answerCacheMode(ctx context.Context) string {
+	if structuredAnswerFrom(ctx) != nil {
+		return "structured"
+	}
+	return "text"
+}
+
+// toCache returns what the answer cache keeps for an answer with the given text: the
+// text, or the whole typed answer as JSON if one was asked for.
+func toCache(ctx context.Context, text string) string {
+	answer := structuredAnswerFrom(ctx)
+	if answer == nil {
+		return text
+	}
+	encoded, err := json.Marshal(answer)
+	if err != nil {
+		return text
+	}
+	return string(encoded)
+}
+
+// fromCache restores an answer kept by toCache and returns its text. It reports false
+// if the cached answer cannot be restored.
+func fromCache(ctx context.Context, cached string) (string, bool) {
+	answer := structuredAnswerFrom(ctx)
+	if answer == nil {
+		return cached, true
+	}
+	if err := json.Unmarshal([]byte(cached), answer); err != nil || answer.Text == "" {
+		*answer = Answer{}
+		return "", false
+	}
+	return answer.Text, true
+}
+
+// parseStructuredReply turns the model's final message into answer and returns the text
+// to keep in the conversation. A reply that does not follow the schema, such as a
+// refusal, is kept as text with no confidence.
+func (bot *ChatBot) parseStructuredReply(ctx context.Context, message openai.ChatCompletionMessage, answer *Answer) string {
+	var reply structuredReply
+	if message.Refusal != "" || json.Unmarshal([]byte(message.Content), &reply) != nil || reply.Text == "" {
+		slog.WarnContext(ctx, "Model did not return a structured answer", "refusal", message.Refusal)
+		text := message.Content
+		if message.Refusal != "" {
+			text = message.Refusal
+		}
+		*answer = Answer{Text: text, Intent: intentOther}
+		return text
+	}
+
+	*answer = Answer{Text: reply.Text, FollowUps: reply.FollowUps, Confidence: min(max(reply.Confidence, 0), 1), Intent: reply.Intent}
+	if len(answer.FollowUps) > maxFollowUps {
+		answer.FollowUps = answer.FollowUps[:maxFollowUps]
+	}
+	if !validIntent(answer.Intent) {
+		answer.Intent = intentOther
+	}
+	for _, crn := range reply.CitedCRNs {
+		if course, ok := bot.metadata.CourseByCRN(strings.TrimSpace(crn)); ok {
+			answer.Sections = append(answer.Sections, course)
+		} else {
+			slog.DebugContext(ctx, "Dropped citation of unknown section", "crn", crn)
+		}
+	}
+	return answer.Text
+}
+
+func validIntent(intent string) bool {
+	for _, known := range intents {
+		if intent == known {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAnswer renders a typed answer as text: the answer, a table of the sections it
+// cites, then any suggested follow-up questions.
+func writeAnswer(w io.Writer, answer *Answer, style TableStyle) error {
+	var b strings.Builder
+	b.WriteString(answer.Text)
+	b.WriteString("\n")
+	if len(answer.Sections) > 0 {
+		b.WriteString("\n")
+		writeCourseTable(&b, answer.Sections, style)
+	}
+	if len(answer.FollowUps) > 0 {
+		b.WriteString("\nYou could also ask:\n")
+		for _, followUp := range answer.FollowUps {
+			fmt.Fprintf(&b, "  - %s\n", followUp)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// structuredLLM is a stand-in model that replies following the answer schema when
+// asked to, citing a known and an unknown section.
+func structuredLLM(t *testing.T, calls *atomic.Int32) *LLMClient {
+	return newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		req, err := decodeCompletionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var format struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Name   string          `json:"name"`
+				Strict bool            `json:"strict"`
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		}
+		if err := json.Unmarshal(req.ResponseFormat, &format); err != nil || format.Type != "json_schema" || !format.JSONSchema.Strict ||
+			!strings.Contains(string(format.JSONSchema.Schema), `"cited_crns"`) {
+			http.Error(w, "expected a strict JSON schema response format, got "+string(req.ResponseFormat), http.StatusBadRequest)
+			return
+		}
+		reply, _ := json.Marshal(structuredReply{
+			Text:       "CS 110-01 is taught by Philip Peterson.",
+			CitedCRNs:  []string{"41001", "99999"},
+			FollowUps:  []string{"When does it meet?", "What is his email?", "Is there a lab?", "Who else teaches CS 110?"},
+			Confidence: 1.5,
+			Intent:     intentInstructor,
+		})
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: string(reply)},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	})
+}
+
+func TestAnswerStructured(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	var calls atomic.Int32
+	chatbot := NewChatBot(structuredLLM(t, &calls), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	session := NewSession("alice")
+
+	answer, err := chatbot.AnswerStructured(context.Background(), session, "Who teaches CS 110?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text != "CS 110-01 is taught by Philip Peterson." || answer.Intent != intentInstructor || answer.Confidence != 1 {
+		t.Errorf("Unexpected answer %+v", answer)
+	}
+	if len(answer.Sections) != 1 || answer.Sections[0].CRN != "41001" {
+		t.Errorf("Expected only the known section to be cited, got %+v", answer.Sections)
+	}
+	if len(answer.FollowUps) != maxFollowUps {
+		t.Errorf("Expected %d follow-ups, got %v", maxFollowUps, answer.FollowUps)
+	}
+	messages := session.Messages()
+	if last := messages[len(messages)-1]; last.Content != answer.Text {
+		t.Errorf("Expected the conversation to keep just the text, got %q", last.Content)
+	}
+
+	// Replies given without the model still come back typed
+	answer, err = chatbot.AnswerStructured(context.Background(), NewSession("bob"), "Who teaches ASTRO 999?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Text != notInScheduleAnswer() || answer.Intent != intentOther || answer.Sections == nil || answer.FollowUps == nil {
+		t.Errorf("Unexpected answer %+v", answer)
+	}
+}
+
+func TestAskReturnsStructuredAnswer(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	var calls atomic.Int32
+	chatbot := NewChatBot(structuredLLM(t, &calls), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetAnswerCache(NewAnswerCache(DefaultConfig().Answers))
+	handler := newServer(NewSessionManager(chatbot, time.Hour))
+
+	for i := 0; i < 2; i++ {
+		recorder := postQuestion(handler, `{"question": "Who teaches CS 110?"}`, "")
+		var response askResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Expected JSON, got %d %q", recorder.Code, recorder.Body.String())
+		}
+		if response.Answer != "CS 110-01 is taught by Philip Peterson." || len(response.Sections) != 1 || response.Sections[0].CRN != "41001" ||
+			response.Intent != intentInstructor || len(response.FollowUps) != maxFollowUps {
+			t.Errorf("Request %d: unexpected response %+v", i+1, response)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected the repeated question to be answered from the cache, got %d completions", calls.Load())
+	}
+}
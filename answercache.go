@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AnswerCache remembers answers to standalone questions so that a repeated question
+// skips the completion. An answer is reused only for a question retrieving exactly the
+// same documents with the same content, so re-ingesting changed course data
+// invalidates it automatically. Among those, a question matches if it normalizes to the
+// same text or is a near duplicate by embedding (or, without embeddings, word overlap).
+type AnswerCache struct {
+	ttl            time.Duration
+	similarity     float64
+	wordSimilarity float64
+	maxEntries     int
+
+	mu      sync.Mutex
+	entries map[string][]*cachedAnswer // Keyed by retrieval fingerprint
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// cachedAnswer is one remembered answer.
+type cachedAnswer struct {
+	normalized string
+	terms      map[string]bool
+	vector     []float32 // Question embedding, nil without a vector store
+	answer     string
+	stored     time.Time
+}
+
+// AnswerCacheStats reports cache use since the cache was created.
+type AnswerCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// NewAnswerCache creates an empty cache.
+func NewAnswerCache(cfg AnswerCacheConfig) *AnswerCache {
+	return &AnswerCache{
+		ttl:            cfg.TTL,
+		similarity:     cfg.Similarity,
+		wordSimilarity: cfg.WordSimilarity,
+		maxEntries:     cfg.MaxEntries,
+		entries:        make(map[string][]*cachedAnswer),
+	}
+}
+
+// bypassAnswerCacheKey marks contexts whose question must not use the answer cache.
+type bypassAnswerCacheKey struct{}
+
+// WithoutAnswerCache returns a context under which questions are always answered anew.
+func WithoutAnswerCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassAnswerCacheKey{}, true)
+}
+
+// answerCacheBypassed reports whether ctx came from WithoutAnswerCache.
+func answerCacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassAnswerCacheKey{}).(bool)
+	return bypass
+}
+
+// retrievalFingerprint identifies the retrieved documents by ID and content.
+func retrievalFingerprint(documents []RetrievedDocument) string {
+	keys := make([]string, len(documents))
+	for i, doc := range documents {
+		keys[i] = doc.ID + ":" + contentHash(doc.Document)[:12]
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeQuestion lowercases a question and drops punctuation and stop words.
+func normalizeQuestion(question string) string {
+	return strings.Join(searchTerms(question), " ")
+}
+
+// Lookup returns a fresh answer to a question matching this one for the same retrieval.
+func (c *AnswerCache) Lookup(fingerprint, question string, vector []float32, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	probe := newCachedAnswer(question, vector, "", now)
+	var fresh []*cachedAnswer
+	var found *cachedAnswer
+	for _, entry := range c.entries[fingerprint] {
+		if c.ttl > 0 && now.Sub(entry.stored) > c.ttl {
+			continue
+		}
+		fresh = append(fresh, entry)
+		if found == nil && c.matches(entry, probe) {
+			found = entry
+		}
+	}
+	// Expired entries are dropped as they are encountered
+	if len(fresh) == 0 {
+		delete(c.entries, fingerprint)
+	} else {
+		c.entries[fingerprint] = fresh
+	}
+
+	if found == nil {
+		c.misses.Add(1)
+		return "", false
+	}
+	c.hits.Add(1)
+	return found.answer, true
+}
+
+// Store remembers the answer to a question.
+func (c *AnswerCache) Store(fingerprint, question string, vector []float32, answer string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxEntries > 0 && c.count() >= c.maxEntries {
+		c.evictOldest()
+	}
+	c.entries[fingerprint] = append(c.entries[fingerprint], newCachedAnswer(question, vector, answer, now))
+}
+
+// Stats returns the hit and miss counts and the number of remembered answers.
+func (c *AnswerCache) Stats() AnswerCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return AnswerCacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: c.count()}
+}
+
+// matches reports whether a cached question is the same as or a near duplicate of probe.
+func (c *AnswerCache) matches(entry, probe *cachedAnswer) bool {
+	if entry.normalized == probe.normalized {
+		return true
+	}
+	if entry.vector != nil && probe.vector != nil {
+		return cosineSimilarity(entry.vector, probe.vector) >= c.similarity
+	}
+	// Word overlap scores lower than embeddings, so it has its own threshold
+	return jaccard(entry.terms, probe.terms) >= c.wordSimilarity
+}
+
+// count returns the number of entries. The caller holds c.mu.
+func (c *AnswerCache) count() int {
+	n := 0
+	for _, entries := range c.entries {
+		n += len(entries)
+	}
+	return n
+}
+
+// evictOldest drops the least recently stored answer. The caller holds c.mu.
+func (c *AnswerCache) evictOldest() {
+	var oldestKey string
+	oldestIndex := -1
+	for key, entries := range c.entries {
+		for i, entry := range entries {
+			if oldestIndex < 0 || entry.stored.Before(c.entries[oldestKey][oldestIndex].stored) {
+				oldestKey, oldestIndex = key, i
+			}
+		}
+	}
+	if oldestIndex < 0 {
+		return
+	}
+	entries := c.entries[oldestKey]
+	c.entries[oldestKey] = append(entries[:oldestIndex:oldestIndex], entries[oldestIndex+1:]...)
+	if len(c.entries[oldestKey]) == 0 {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// newCachedAnswer prepares a question for matching.
+func newCachedAnswer(question string, vector []float32, answer string, now time.Time) *cachedAnswer {
+	terms := make(map[string]bool)
+	for _, term := range searchTerms(question) {
+		terms[term] = true
+	}
+	return &cachedAnswer{normalized: normalizeQuestion(question), terms: terms, vector: vector, answer: answer, stored: now}
+}
+
+// cosineSimilarity compares two embeddings.
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// jaccard is the overlap of two word sets.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestAnswerCacheMatching(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	cache := NewAnswerCache(AnswerCacheConfig{TTL: time.Hour, Similarity: 0.75, WordSimilarity: 0.8, MaxEntries: 2})
+	documents := []RetrievedDocument{{ID: "41001", Document: `{"CRN":"41001"}`}, {ID: "41002", Document: `{"CRN":"41002"}`}}
+	fingerprint := retrievalFingerprint(documents)
+
+	cache.Store(fingerprint, "Who teaches CS 110?", nil, "Philip Peterson", now)
+	if answer, ok := cache.Lookup(fingerprint, "who teaches cs 110", nil, now); !ok || answer != "Philip Peterson" {
+		t.Errorf("Expected a normalized match, got %q, %v", answer, ok)
+	}
+	if _, ok := cache.Lookup(fingerprint, "Who teaches CS 110, please?", nil, now); !ok {
+		t.Error("Expected a near duplicate to match")
+	}
+	if _, ok := cache.Lookup(fingerprint, "When does CS 110 meet?", nil, now); ok {
+		t.Error("Expected a different question to miss")
+	}
+	if _, ok := cache.Lookup(retrievalFingerprint(documents[:1]), "Who teaches CS 110?", nil, now); ok {
+		t.Error("Expected different retrieved sections to miss")
+	}
+
+	// Changed course data changes the fingerprint even for the same CRNs.
+	changed := []RetrievedDocument{documents[0], {ID: "41002", Document: `{"CRN":"41002","Room":"LS 210"}`}}
+	if retrievalFingerprint(changed) == fingerprint {
+		t.Error("Expected changed document content to change the fingerprint")
+	}
+
+	// Near duplicates by embedding take precedence over word overlap.
+	cache.Store(fingerprint, "Which room is CS 110 in?", []float32{1, 0}, "LS 210", now)
+	if answer, ok := cache.Lookup(fingerprint, "Where does CS 110 meet?", []float32{0.9, 0.1}, now); !ok || answer != "LS 210" {
+		t.Errorf("Expected an embedding near duplicate to match, got %q, %v", answer, ok)
+	}
+
+	if _, ok := cache.Lookup(fingerprint, "Who teaches CS 110?", nil, now.Add(2*time.Hour)); ok {
+		t.Error("Expected an expired answer to miss")
+	}
+	if stats := cache.Stats(); stats.Hits != 3 || stats.Entries != 0 {
+		t.Errorf("Expected 3 hits and expired entries dropped, got %+v", stats)
+	}
+}
+
+func TestAnswerCacheKeepsDifferentQuestionsApart(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	cache := NewAnswerCache(DefaultConfig().Answers)
+	// Both questions retrieve the same section, so they share a fingerprint
+	fingerprint := retrievalFingerprint([]RetrievedDocument{{ID: "41001", Document: `{"CRN":"41001"}`}})
+
+	// Embeddings of different questions about one course are typically about 0.93 alike
+	cache.Store(fingerprint, "Who teaches CS 110?", []float32{1, 0}, "Philip Peterson", now)
+	if answer, ok := cache.Lookup(fingerprint, "When does CS 110 meet?", []float32{0.93, 0.3676}, now); ok {
+		t.Errorf("Expected a different question about the same course to miss, got %q", answer)
+	}
+	if _, ok := cache.Lookup(fingerprint, "Who is teaching CS 110?", []float32{0.995, 0.0999}, now); !ok {
+		t.Error("Expected a rephrasing of the same question to match")
+	}
+}
+
+func TestAnswerCacheWordOverlap(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	cache := NewAnswerCache(DefaultConfig().Answers)
+	fingerprint := retrievalFingerprint([]RetrievedDocument{{ID: "41001", Document: `{"CRN":"41001"}`}})
+
+	// Without embeddings, questions are compared by their words with the word threshold
+	cache.Store(fingerprint, "Is CS 110 full this term?", nil, "Yes", now)
+	if _, ok := cache.Lookup(fingerprint, "This term, is CS 110 full?", nil, now); !ok {
+		t.Error("Expected the same words in another order to match")
+	}
+	cache.Store(fingerprint, "Is section 01 of CS 110 full this term?", nil, "Yes", now)
+	if _, ok := cache.Lookup(fingerprint, "Is section 01 of CS 110 full this term, please?", nil, now); !ok {
+		t.Error("Expected a long question with one more word to match")
+	}
+	for _, question := range []string{"Is CS 110 not full this term?", "Is CS 112 full this term?", "Is CS 110 full?"} {
+		if answer, ok := cache.Lookup(fingerprint, question, nil, now); ok {
+			t.Errorf("Expected %q to miss, got %q", question, answer)
+		}
+	}
+}
+
+func TestAnswerCacheSkipsToolAnswers(t *testing.T) {
+	var completions atomic.Int32
+	llm := newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		completions.Add(1)
+		req, err := decodeCompletionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Search the web first, then answer from the results
+		message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "See the registrar's page."}
+		if last := req.Messages[len(req.Messages)-1]; last.Role != openai.ChatMessageRoleTool {
+			message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+				ID:       "call-1",
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: WebSearchTool().Name, Arguments: `{"query": "CS 110 registration"}`},
+			}}}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: message, FinishReason: openai.FinishReasonStop}},
+		})
+	})
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	chatbot := NewChatBot(llm, &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetSearchProvider(NewHTTPSearchProvider(newStandInSearchServer(t, nil).URL, ""))
+	chatbot.SetAnswerCache(NewAnswerCache(DefaultConfig().Answers))
+	sessions := NewSessionManager(chatbot, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := sessions.Answer(context.Background(), "", "How do I register for CS 110?"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if completions.Load() != 4 || chatbot.AnswerCache().Stats().Entries != 0 {
+		t.Errorf("Expected answers that searched the web not to be cached, got %d completions and %+v", completions.Load(), chatbot.AnswerCache().Stats())
+	}
+}
+
+func TestAnswerCacheSkipsCompletion(t *testing.T) {
+	var completions atomic.Int32
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	chatbot := NewChatBot(echoLLM(t, &completions), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetAnswerCache(NewAnswerCache(DefaultConfig().Answers))
+	sessions := NewSessionManager(chatbot, time.Hour)
+	ctx := context.Background()
+
+	_, first, err := sessions.Answer(ctx, "", "Who teaches CS 110?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, second, err := sessions.Answer(ctx, "", "who teaches cs 110")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completions.Load() != 1 || second != first {
+		t.Errorf("Expected the second user to get the cached answer, got %d completions and %q", completions.Load(), second)
+	}
+
+	// Follow-ups depend on the conversation, so they are never served from the cache.
+	if _, _, err := sessions.Answer(ctx, bob, "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+	if completions.Load() != 2 {
+		t.Errorf("Expected a follow-up to be answered anew, got %d completions", completions.Load())
+	}
+
+	if _, _, err := sessions.Answer(WithoutAnswerCache(ctx), "", "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+	if completions.Load() != 3 {
+		t.Errorf("Expected a bypassed question to be answered anew, got %d completions", completions.Load())
+	}
+}
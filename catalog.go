@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gocarina/gocsv"
+)
+
+// ErrPrerequisiteCycle is returned when catalog prerequisites depend on each other in a loop.
+var ErrPrerequisiteCycle = errors.New("prerequisite cycle")
+
+// catalogRecord is a row of the catalog file. Prerequisites and corequisites are lists of
+// course codes separated by semicolons or commas, e.g. "CS 110; MATH 109".
+type catalogRecord struct {
+	Code          string `csv:"Course Code"`
+	Description   string `csv:"Description"`
+	Units         string `csv:"Units"`
+	Prerequisites string `csv:"Prerequisites"`
+	Corequisites  string `csv:"Corequisites"`
+}
+
+// CatalogEntry holds the catalog description of a course.
+type CatalogEntry struct {
+	Code          string   `json:"code"` // Normalized code, e.g. "CS 272"
+	Description   string   `json:"description"`
+	Units         string   `json:"units"`
+	Prerequisites []string `json:"prerequisites,omitempty"`
+	Corequisites  []string `json:"corequisites,omitempty"`
+}
+
+// Catalog indexes catalog entries by course code and forms the prerequisite graph.
+type Catalog struct {
+	entries map[string]*CatalogEntry
+}
+
+var catalogCodePattern = regexp.MustCompile(`(?i)^([a-z&]{2,5})\s*-?\s*(\d{2,3}[a-z]?)$`)
+
+// normalizeCourseCode turns "cs272" or "CS-272" into "CS 272". Codes that do not look
+// like a subject and number are returned trimmed and upper-cased.
+func normalizeCourseCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if match := catalogCodePattern.FindStringSubmatch(code); match != nil {
+		return match[1] + " " + match[2]
+	}
+	return code
+}
+
+// courseCode returns the normalized catalog code of a scheduled section.
+func courseCode(course Course) string {
+	return normalizeCourseCode(course.Subject + " " + course.CourseNumber)
+}
+
+// LoadCatalog reads a catalog CSV file with the columns Course Code, Description, Units,
+// Prerequisites and Corequisites. It fails if the prerequisites contain a cycle.
+func LoadCatalog(path string) (*Catalog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening catalog: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	var records []catalogRecord
+	if err := gocsv.UnmarshalCSV(reader, &records); err != nil {
+		return nil, fmt.Errorf("Error reading catalog: %w", err)
+	}
+
+	catalog := &Catalog{entries: make(map[string]*CatalogEntry)}
+	for _, record := range records {
+		code := normalizeCourseCode(record.Code)
+		if code == "" {
+			continue
+		}
+		catalog.entries[code] = &CatalogEntry{
+			Code:          code,
+			Description:   strings.TrimSpace(record.Description),
+			Units:         strings.TrimSpace(record.Units),
+			Prerequisites: splitCourseCodes(record.Prerequisites),
+			Corequisites:  splitCourseCodes(record.Corequisites),
+		}
+	}
+
+	if cycle := catalog.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPrerequisiteCycle, strings.Join(cycle, " -> "))
+	}
+	return catalog, nil
+}
+
+// splitCourseCodes parses a semicolon or comma separated list of course codes.
+func splitCourseCodes(list string) []string {
+	var codes []string
+	for _, code := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == ',' }) {
+		if code = normalizeCourseCode(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// Lookup returns the catalog entry for a course code.
+func (c *Catalog) Lookup(code string) (*CatalogEntry, bool) {
+	entry, ok := c.entries[normalizeCourseCode(code)]
+	return entry, ok
+}
+
+// ForCourse joins a scheduled section to its catalog entry by subject and course number.
+func (c *Catalog) ForCourse(course Course) (*CatalogEntry, bool) {
+	entry, ok := c.entries[courseCode(course)]
+	return entry, ok
+}
+
+// findCycle returns the courses forming a prerequisite cycle, or nil if there is none.
+func (c *Catalog) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(code string) []string
+	visit = func(code string) []string {
+		state[code] = visiting
+		stack = append(stack, code)
+		if entry, ok := c.entries[code]; ok {
+			for _, prerequisite := range entry.Prerequisites {
+				switch state[prerequisite] {
+				case visiting:
+					// Report the loop from the first time the prerequisite was entered
+					for i, onStack := range stack {
+						if onStack == prerequisite {
+							return append(append([]string{}, stack[i:]...), prerequisite)
+						}
+					}
+				case unvisited:
+					if cycle := visit(prerequisite); cycle != nil {
+						return cycle
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[code] = done
+		return nil
+	}
+
+	for _, code := range c.codes() {
+		if state[code] == unvisited {
+			if cycle := visit(code); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// codes returns every catalog course code in sorted order.
+func (c *Catalog) codes() []string {
+	codes := make([]string, 0, len(c.entries))
+	for code := range c.entries {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// PathTo returns every course needed before code, in an order in which they can be
+// taken, ending with code itself.
+func (c *Catalog) PathTo(code string) ([]string, error) {
+	code = normalizeCourseCode(code)
+	if _, ok := c.entries[code]; !ok {
+		return nil, fmt.Errorf("%s is not in the catalog", code)
+	}
+
+	var path []string
+	seen := make(map[string]bool)
+	var visit func(code string)
+	visit = func(code string) {
+		if seen[code] {
+			return
+		}
+		seen[code] = true
+		if entry, ok := c.entries[code]; ok {
+			for _, prerequisite := range entry.Prerequisites {
+				visit(prerequisite)
+			}
+		}
+		path = append(path, code)
+	}
+	visit(code)
+	return path, nil
+}
+
+// NextCourses returns the courses a student can take after completing the given courses,
+// assuming they also completed everything those courses required. Only courses with at
+// least one prerequisite are returned.
+func (c *Catalog) NextCourses(completed ...string) []string {
+	done := make(map[string]bool)
+	for _, code := range completed {
+		if path, err := c.PathTo(code); err == nil {
+			for _, prerequisite := range path {
+				done[prerequisite] = true
+			}
+		} else {
+			done[normalizeCourseCode(code)] = true
+		}
+	}
+
+	var next []string
+	for _, code := range c.codes() {
+		entry := c.entries[code]
+		if done[code] || len(entry.Prerequisites) == 0 {
+			continue
+		}
+		eligible := true
+		for _, prerequisite := range entry.Prerequisites {
+			if !done[prerequisite] {
+				eligible = false
+				break
+			}
+		}
+		if eligible {
+			next = append(next, code)
+		}
+	}
+	return next
+}
+
+// SetCatalog attaches catalog descriptions to the chatbot and offers the prerequisite
+// tools to the model.
+func (bot *ChatBot) SetCatalog(catalog *Catalog) {
+	bot.catalog = catalog
+	bot.registerTool(CoursePrerequisitesTool(), bot.handleCoursePrerequisites)
+	bot.registerTool(NextCoursesTool(), bot.handleNextCourses)
+	bot.registerTool(PrerequisitePathTool(), bot.handlePrerequisitePath)
+}
+
+// offeredSections lists the scheduled sections of a course code this term.
+func (bot *ChatBot) offeredSections(code string) []string {
+	var sections []string
+	for _, course := range bot.metadata.courses {
+		if courseCode(course) == code {
+			sections = append(sections, fmt.Sprintf("%s-%s (CRN %s)", code, course.Section, course.CRN))
+		}
+	}
+	return sections
+}
+
+// describeCourses renders course codes with whether they are offered this term.
+func (bot *ChatBot) describeCourses(codes []string) string {
+	var lines []string
+	for _, code := range codes {
+		if sections := bot.offeredSections(code); len(sections) > 0 {
+			lines = append(lines, fmt.Sprintf("%s (offered %s: %s)", code, scheduleTerm, strings.Join(sections, ", ")))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s (not offered %s)", code, scheduleTerm))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleCoursePrerequisites runs the course_prerequisites tool.
+func (bot *ChatBot) handleCoursePrerequisites(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Course string `json:"course"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	entry, ok := bot.catalog.Lookup(args.Course)
+	if !ok {
+		return fmt.Sprintf("%s is not in the catalog.", normalizeCourseCode(args.Course)), nil
+	}
+
+	result, err := json.Marshal(struct {
+		*CatalogEntry
+		OfferedSections []string `json:"offered_sections"`
+	}{entry, bot.offeredSections(entry.Code)})
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// handleNextCourses runs the courses_after tool.
+func (bot *ChatBot) handleNextCourses(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Completed []string `json:"completed"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	next := bot.catalog.NextCourses(args.Completed...)
+	if len(next) == 0 {
+		return "No further courses require these as prerequisites.", nil
+	}
+	return bot.describeCourses(next), nil
+}
+
+// handlePrerequisitePath runs the prerequisite_path tool.
+func (bot *ChatBot) handlePrerequisitePath(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Course string `json:"course"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	path, err := bot.catalog.PathTo(args.Course)
+	if err != nil {
+		return err.Error(), nil
+	}
+	return "Take these in order:\n" + bot.describeCourses(path), nil
+}
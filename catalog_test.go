@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeCatalog writes a catalog file with the given rows below the header.
+func writeCatalog(t *testing.T, rows ...string) string {
+	path := filepath.Join(t.TempDir(), "catalog.csv")
+	content := "Course Code,Description,Units,Prerequisites,Corequisites\n" + strings.Join(rows, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrerequisiteGraph(t *testing.T) {
+	catalog, err := LoadCatalog(writeCatalog(t,
+		`CS 110,Introduction to Computer Science I,4,,`,
+		`CS 112,Introduction to Computer Science II,4,CS 110,`,
+		`MATH 201,Discrete Mathematics,4,,`,
+		`CS 245,Data Structures and Algorithms,4,"CS 112; MATH 201",`,
+		`CS 272,Software Development,4,cs112,CS 272L`,
+		`CS 315,Computer Architecture,4,CS 245,`,
+	))
+	if err != nil {
+		t.Fatalf("LoadCatalog failed: %v", err)
+	}
+
+	entry, ok := catalog.ForCourse(Course{Subject: "CS", CourseNumber: "272"})
+	if !ok || !reflect.DeepEqual(entry.Prerequisites, []string{"CS 112"}) || !reflect.DeepEqual(entry.Corequisites, []string{"CS 272L"}) {
+		t.Errorf("Expected CS 272 to require CS 112 with corequisite CS 272L, got %+v", entry)
+	}
+
+	path, err := catalog.PathTo("CS 315")
+	if err != nil {
+		t.Fatalf("PathTo failed: %v", err)
+	}
+	if want := []string{"CS 110", "CS 112", "MATH 201", "CS 245", "CS 315"}; !reflect.DeepEqual(path, want) {
+		t.Errorf("Expected path %v, got %v", want, path)
+	}
+
+	if next := catalog.NextCourses("CS 112"); !reflect.DeepEqual(next, []string{"CS 272"}) {
+		t.Errorf("Expected only CS 272 after CS 112, got %v", next)
+	}
+	if next := catalog.NextCourses("CS 112", "MATH 201"); !reflect.DeepEqual(next, []string{"CS 245", "CS 272"}) {
+		t.Errorf("Expected CS 245 and CS 272 after CS 112 and MATH 201, got %v", next)
+	}
+}
+
+func TestPrerequisiteCycle(t *testing.T) {
+	_, err := LoadCatalog(writeCatalog(t,
+		`CS 110,Intro,4,CS 112,`,
+		`CS 112,Intro II,4,CS 110,`,
+	))
+	if !errors.Is(err, ErrPrerequisiteCycle) {
+		t.Errorf("Expected a prerequisite cycle error, got %v", err)
+	}
+}
@@ -2,9 +2,14 @@
 
 import (
     "context"
+    "encoding/json"
     "fmt"
+    "slices"
+    "sort"
     "strings"
-    "log"
+    "log/slog"
+    "sync"
+    "time"
 
     chroma "github.com/amikos-tech/chroma-go"
     openai "github.com/sashabaranov/go-openai"
@@ -13,41 +18,270 @@ import (
 
 
 
-// ChatBot uses LLMClient and MetadataExtractor to answer questions
+// ChatBot uses LLMClient and MetadataExtractor to answer questions. Everything it holds
+// is shared by all conversations and, once configured, only read while answering or
+// guarded by a lock, so one ChatBot can answer many Sessions at once. Its own session
+// backs AnswerQuestion.
 type ChatBot struct {
     llmClient            *LLMClient
     metadata             *MetadataExtractor
-    chromaCtx            context.Context
-    chromaClient         *chroma.Client
-    courseCollection     *chroma.Collection
-    instructorCollection *chroma.Collection
-    context              []openai.ChatCompletionMessage
+    session              *Session // Conversation used by AnswerQuestion
+    retrieval            RetrievalConfig
+    search               SearchProvider
+    catalog              *Catalog // Catalog descriptions and prerequisites, nil if not loaded
+    profiles             []InstructorProfile
+    rooms                *RoomIndex
+    clock                Clock
+    tools                map[string]registeredTool
+    storeMu              sync.Mutex
+    store                vectorStore // Guarded by storeMu; empty while the store could not be reached
+    storeErr             error       // Why the vector store is being bypassed, nil when it is healthy
+    connect              func(context.Context) (vectorStore, error) // Reaches the store again, nil if it cannot
+    connecting           bool        // A reconnection is under way
+    lastConnect          time.Time   // When the last reconnection started
+    timeouts             TimeoutConfig
+    answers              *AnswerCache // Answers to repeated questions, nil if disabled
+    usage                *UsageTracker
+    tracer               *Tracer // Records where each answer's time went, nil if tracing is off
+    prompts              *Prompts
 }
 
+// vectorStore holds the ChromaDB client and the collections answers are retrieved from.
+type vectorStore struct {
+    client      *chroma.Client
+    courses     *chroma.Collection
+    instructors *chroma.Collection
+    documents   *chroma.Collection // Chunks of university pages, nil if not ingested
+}
+
+// storeRetryInterval is how long to wait between attempts to reconnect to the vector
+// store after it could not be reached at startup.
+const storeRetryInterval = 30 * time.Second
+
+// toolHandler runs a tool call with the JSON arguments chosen by the model and returns
+// the result passed back to it. The context is cancelled when the question is.
+type toolHandler func(ctx context.Context, arguments string) (string, error)
+
+// registeredTool pairs a function definition offered to the model with its handler.
+type registeredTool struct {
+    definition openai.FunctionDefinition
+    handle     toolHandler
+}
+
+// maxToolRounds limits how many rounds of tool calls a single answer may take.
+const maxToolRounds = 3
 
-// NewChatBot initializes a ChatBot with an LLM client, metadata extractor, and ChromaDB context
-func NewChatBot(llmClient *LLMClient, metadata *MetadataExtractor, chromaCtx context.Context, chromaClient *chroma.Client, courseCollection, instructorCollection *chroma.Collection) *ChatBot {
-    return &ChatBot{
+// webSearchResults is the number of links returned for a web search.
+const webSearchResults = 5
+
+
+// NewChatBot initializes a ChatBot with an LLM client, metadata extractor, and ChromaDB collections
+func NewChatBot(llmClient *LLMClient, metadata *MetadataExtractor, chromaClient *chroma.Client, courseCollection, instructorCollection *chroma.Collection) *ChatBot {
+    bot := &ChatBot{
         llmClient:            llmClient,
         metadata:             metadata,
-        chromaCtx:            chromaCtx,
-        chromaClient:         chromaClient,
-        courseCollection:     courseCollection,
-        instructorCollection: instructorCollection,
-        context: []openai.ChatCompletionMessage{
-            {
-                Role:    openai.ChatMessageRoleSystem,
-                Content: "You are a course assistant. Help users find course information.",
-            },
-        },
+        store:                vectorStore{client: chromaClient, courses: courseCollection, instructors: instructorCollection},
+        retrieval:            DefaultConfig().Retrieval,
+        timeouts:             DefaultConfig().Timeouts,
+        usage:                NewUsageTracker(DefaultConfig().Usage),
+        prompts:              defaultPrompts,
+        session:              NewSession("default"),
+        profiles: BuildInstructorProfiles(metadata.courses),
+        rooms:    NewRoomIndex(metadata.courses),
+        clock:    systemClock{},
+        tools:    make(map[string]registeredTool),
+    }
+    bot.registerTool(WebSearchTool(), bot.handleWebSearch)
+    bot.registerTool(LookupInstructorTool(), bot.handleLookupInstructor)
+    bot.registerTool(RoomScheduleTool(), bot.handleRoomSchedule)
+    bot.registerTool(FindFreeRoomTool(), bot.handleFindFreeRoom)
+    return bot
+}
+
+// InstructorProfile returns the profile of the named instructor.
+func (bot *ChatBot) InstructorProfile(name string) (*InstructorProfile, bool) {
+    return FindInstructorProfile(bot.profiles, name)
+}
+
+// Rooms returns the room occupancy index built from the schedule.
+func (bot *ChatBot) Rooms() *RoomIndex {
+    return bot.rooms
+}
+
+// SetRetrievalConfig changes how many documents are retrieved and which are relevant.
+func (bot *ChatBot) SetRetrievalConfig(retrieval RetrievalConfig) {
+    bot.retrieval = retrieval
+}
+
+// SetTimeouts changes how long each stage of answering a question may take.
+func (bot *ChatBot) SetTimeouts(timeouts TimeoutConfig) {
+    bot.timeouts = timeouts
+}
+
+// SetAnswerCache enables reuse of answers to repeated questions.
+func (bot *ChatBot) SetAnswerCache(answers *AnswerCache) {
+    bot.answers = answers
+}
+
+// AnswerCache returns the answer cache, or nil if it is disabled.
+func (bot *ChatBot) AnswerCache() *AnswerCache {
+    return bot.answers
+}
+
+// SetUsageTracker replaces the tracker that accounts for model usage and enforces budgets.
+func (bot *ChatBot) SetUsageTracker(usage *UsageTracker) {
+    bot.usage = usage
+}
+
+// SetPrompts replaces the templates prompts are rendered from.
+func (bot *ChatBot) SetPrompts(prompts *Prompts) {
+    bot.prompts = prompts
+}
+
+// Prompts returns the templates prompts are rendered from.
+func (bot *ChatBot) Prompts() *Prompts {
+    return bot.prompts
+}
+
+// Model returns the chat model questions are answered with, before any downgrade for
+// exceeding a usage budget.
+func (bot *ChatBot) Model() string {
+    if bot.llmClient == nil {
+        return ""
+    }
+    return bot.llmClient.model
+}
+
+// SetModel changes the chat model questions are answered with. Answers cached from
+// another model are not reused.
+func (bot *ChatBot) SetModel(model string) {
+    bot.llmClient.SetModel(model)
+}
+
+// SetTracer enables tracing of each answered question.
+func (bot *ChatBot) SetTracer(tracer *Tracer) {
+    bot.tracer = tracer
+}
+
+// EmbeddingCache returns the cache behind the course collection's embeddings, or nil if
+// embeddings are not cached.
+func (bot *ChatBot) EmbeddingCache() *EmbeddingCache {
+    courses := bot.vectorStore().courses
+    if courses == nil {
+        return nil
+    }
+    if cached, ok := courses.EmbeddingFunction.(*cachedEmbeddingFunction); ok {
+        return cached.cache
+    }
+    return nil
+}
+
+// Close releases the trace file, if any.
+func (bot *ChatBot) Close() error {
+    return bot.tracer.Close()
+}
+
+// Usage returns the tracker that accounts for model usage.
+func (bot *ChatBot) Usage() *UsageTracker {
+    return bot.usage
+}
+
+// SetClock replaces the clock used to answer questions relative to now.
+func (bot *ChatBot) SetClock(clock Clock) {
+    bot.clock = clock
+}
+
+// SetSearchProvider sets the provider used for web page searches.
+func (bot *ChatBot) SetSearchProvider(search SearchProvider) {
+    bot.search = search
+}
+
+// SetDocumentCollection enables retrieval from ingested university pages.
+func (bot *ChatBot) SetDocumentCollection(collection *chroma.Collection) {
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    bot.store.documents = collection
+}
+
+// vectorStore returns the client and collections currently retrieved from.
+func (bot *ChatBot) vectorStore() vectorStore {
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    return bot.store
+}
+
+// SetStoreConnector sets how to reach the vector store when it could not be reached at
+// startup. While degraded without collections, questions start an attempt in the
+// background at most once per storeRetryInterval, and answer from the in-process course
+// data until one succeeds.
+func (bot *ChatBot) SetStoreConnector(connect func(context.Context) (vectorStore, error)) {
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    bot.connect = connect
+}
+
+// reconnectInBackground starts an attempt to reach the vector store if it has no
+// collections, none is under way and the last was long enough ago.
+func (bot *ChatBot) reconnectInBackground() {
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    now := bot.clock.Now()
+    if bot.connect == nil || bot.store.courses != nil || bot.connecting || now.Sub(bot.lastConnect) < storeRetryInterval {
+        return
+    }
+    bot.connecting, bot.lastConnect = true, now
+    go bot.reconnect(context.Background())
+}
+
+// reconnect tries to reach the vector store, and on success retrieves from it again.
+func (bot *ChatBot) reconnect(ctx context.Context) error {
+    store, err := bot.connect(ctx)
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    bot.connecting = false
+    if err != nil {
+        slog.WarnContext(ctx, "Vector store still unavailable", "err", err)
+        bot.storeErr = err
+        return err
     }
+    slog.InfoContext(ctx, "Vector store available again")
+    bot.store, bot.storeErr = store, nil
+    return nil
+}
+
+// SetDegraded records that the vector store is unavailable, so questions are answered
+// from the in-process course data until a query succeeds again.
+func (bot *ChatBot) SetDegraded(err error) {
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    bot.storeErr = err
+}
+
+// Degraded returns the vector store error that forced the in-process fallback, or nil
+// if the store is healthy or was never configured.
+func (bot *ChatBot) Degraded() error {
+    bot.storeMu.Lock()
+    defer bot.storeMu.Unlock()
+    return bot.storeErr
 }
 
-func (bot *ChatBot) QueryCourses(term string) string {
+// Session returns the conversation used by AnswerQuestion.
+func (bot *ChatBot) Session() *Session {
+    return bot.session
+}
+
+// registerTool offers a function to the model when answering questions.
+func (bot *ChatBot) registerTool(definition openai.FunctionDefinition, handle toolHandler) {
+    bot.tools[definition.Name] = registeredTool{definition: definition, handle: handle}
+}
+
+// QueryCourses lists the courses taught by the instructor named in term, as a table in
+// the given style.
+func (bot *ChatBot) QueryCourses(ctx context.Context, term string, style TableStyle) string {
     // Find the canonical name for the given term
     instructors := InitializeInstructors()
     canonicalName := findCanonicalName(term, instructors)
-    fmt.Printf("Canonical name to search for: %s\n", canonicalName)
+    slog.DebugContext(ctx, "Resolved instructor", "term", term, "instructor", canonicalName)
 
     // If the canonical name is empty, return a fallback message
     if canonicalName == "" {
@@ -55,29 +289,78 @@ func (bot *ChatBot) QueryCourses(term string) string {
     }
 	
     // Query the collection using the canonical name
-    queryResults, err := bot.courseCollection.Query(bot.chromaCtx, []string{canonicalName}, 5, nil, nil, nil)
-    if err != nil {
-        log.Printf("Error querying collection: %v", err)
-        return "An error occurred while searching for courses."
-    }
+    bot.reconnectInBackground()
+    if courseCollection := bot.vectorStore().courses; courseCollection != nil {
+        queryCtx, cancel := withTimeout(ctx, bot.timeouts.Retrieval)
+        queryResults, err := courseCollection.Query(queryCtx, []string{canonicalName}, int32(bot.retrieval.CourseResults), nil, nil, nil)
+        cancel()
+        if err == nil {
+            bot.SetDegraded(nil)
+
+            // Check if results are empty
+            if len(queryResults.Documents) == 0 {
+                return fmt.Sprintf("No courses found for %s.", canonicalName)
+            }
 
-    // Check if results are empty
-    if len(queryResults.Documents) == 0 {
-        return fmt.Sprintf("No courses found for %s.", canonicalName)
+            // Format the results as a table of the sections found
+            var courses []Course
+            for _, documents := range queryResults.Documents {
+                for _, doc := range documents {
+                    var course Course
+                    if err := json.Unmarshal([]byte(doc), &course); err == nil {
+                        courses = append(courses, course)
+                    }
+                }
+            }
+            var result strings.Builder
+            result.WriteString(fmt.Sprintf("Here are the courses taught by %s:\n", canonicalName))
+            writeCourses(&result, courses, formatTable, style)
+            return result.String()
+        }
+        if ctx.Err() != nil {
+            return "The search was cancelled."
+        }
+        slog.WarnContext(ctx, "Failed to query collection", "collection", courseCollection.Name, "err", err)
+        bot.SetDegraded(&StoreError{Op: "query", Collection: courseCollection.Name, Err: err})
     }
 
-    // Format the results
+    // Without a working vector store, filter the course data by instructor instead
     var result strings.Builder
     result.WriteString(fmt.Sprintf("Here are the courses taught by %s:\n", canonicalName))
-    for _, doc := range queryResults.Documents {
-        result.WriteString(fmt.Sprintf("- %s\n", doc))
-    }
-
+    writeCourses(&result, FilterCourses(bot.metadata.courses, CourseFilter{Instructor: canonicalName}), formatTable, style)
     return result.String()
 }
 
-func (bot *ChatBot) AnswerQuestion(question string) (string, error) {
-    
+// AnswerQuestion answers a question in the chatbot's own conversation.
+func (bot *ChatBot) AnswerQuestion(ctx context.Context, question string) (string, error) {
+    return bot.Answer(ctx, bot.session, question)
+}
+
+// Answer answers a question in the context of the session's conversation so far. The
+// whole answer is limited by the question timeout, and cancelling ctx abandons it
+// without recording the question in the conversation. Questions in the same session
+// are answered one at a time; different sessions are answered concurrently. Each
+// question is logged and traced under the request ID of ctx, or a new one.
+func (bot *ChatBot) Answer(ctx context.Context, session *Session, question string) (answer string, err error) {
+    ctx, cancel := withTimeout(ctx, bot.timeouts.Question)
+    defer cancel()
+    ctx = WithUsage(ctx, bot.usage, bot.clock, session.ID, featureAnswer)
+    ctx = ensureRequestID(ctx)
+
+    ctx, span := startTrace(ctx, bot.tracer, "answer")
+    span.SetAttributes(slog.String("session", session.ID), slog.String("prompts", bot.prompts.Version()))
+    start := time.Now()
+    slog.DebugContext(ctx, "Answering question", "session", session.ID, "question", question)
+    defer func() {
+        span.End(err)
+        metrics.stageSeconds.Observe(time.Since(start).Seconds(), stageAnswer)
+        metrics.questions.Add(1, questionOutcome(err))
+        if err != nil {
+            slog.WarnContext(ctx, "Failed to answer question", "session", session.ID, "prompts", bot.prompts.Version(), "duration", time.Since(start), "err", err)
+        } else {
+            slog.InfoContext(ctx, "Answered question", "session", session.ID, "prompts", bot.prompts.Version(), "duration", time.Since(start))
+        }
+    }()
 
     // Check if the question is a web search query
     if strings.Contains(strings.ToLower(question), "take me to the web page") {
@@ -85,77 +368,398 @@ func (bot *ChatBot) AnswerQuestion(question string) (string, error) {
         query := strings.Replace(strings.ToLower(question), "take me to the web page where i can", "", 1)
         query = strings.TrimSpace(query)
 
-        // Perform web search using the LLM
-        webSearchPrompt := fmt.Sprintf("Search the web and provide a list of links for the query: '%s'", query)
-        systemMessage := "You are a web search assistant. Generate a list of clickable links for the query provided."
+        // Look up real pages with the configured search provider
+        details := answerDetailsFrom(ctx)
+        details.setQuestion(question)
+        details.setRoute(routeWebSearch)
+        answer, err = bot.webSearch(ctx, query)
+        cannedAnswer(ctx, answer, intentWebPage)
+        return answer, err
+    }
 
-        webSearchResponse, err := bot.llmClient.ChatCompletion(webSearchPrompt, systemMessage)
-        if err != nil {
-            return "", fmt.Errorf("web search failed: %w", err)
-        }
+    session.mu.Lock()
+    defer session.mu.Unlock()
 
-        return webSearchResponse, nil
+    // Forget this turn if it fails, so a cancelled question leaves no trace in the conversation
+    turnStart := len(session.messages)
+    answer, err = bot.answer(ctx, session, question)
+    if err != nil {
+        session.messages = session.messages[:turnStart]
     }
+    return answer, err
+}
 
+// answer retrieves the documents relevant to a course question and asks the LLM. The
+// caller holds session.mu.
+func (bot *ChatBot) answer(ctx context.Context, session *Session, question string) (string, error) {
     // Add the user's question to the context for course-related queries
-    bot.context = append(bot.context, openai.ChatCompletionMessage{
+    session.add(openai.ChatCompletionMessage{
         Role:    openai.ChatMessageRoleUser,
         Content: question,
     })
 
     // Handle course-related queries as usual
+    details := answerDetailsFrom(ctx)
+    _, aliasSpan := startSpan(ctx, "resolve_aliases")
     instructors := InitializeInstructors()
+    substitutions := 0
     for _, instructor := range instructors {
         for _, alias := range instructor.Aliases {
             if strings.Contains(strings.ToLower(question), strings.ToLower(alias)) {
-                question = strings.ReplaceAll(question, alias, instructor.CanonicalName)
+                substituted := strings.ReplaceAll(question, alias, instructor.CanonicalName)
+                slog.DebugContext(ctx, "Substituted instructor alias", "alias", alias, "instructor", instructor.CanonicalName)
+                if substituted != question {
+                    details.substituted(alias, instructor.CanonicalName)
+                }
+                question = substituted
+                substitutions++
             }
         }
     }
+    aliasSpan.SetAttributes(slog.Int("substitutions", substitutions))
+    aliasSpan.End(nil)
+    details.setQuestion(question)
 
+    // Ask for clarification when the question names a course or instructor ambiguously
+    if clarification := clarifyQuestion(question, bot.metadata.courses, instructors); clarification != "" {
+        details.setRoute(routeClarification)
+        return session.reply(clarification), nil
+    }
+
+    bot.reconnectInBackground()
+    store := bot.vectorStore()
     var collectionToQuery *chroma.Collection
     if strings.Contains(strings.ToLower(question), "instructor") {
-        collectionToQuery = bot.instructorCollection
+        collectionToQuery = store.instructors
     } else {
-        collectionToQuery = bot.courseCollection
+        collectionToQuery = store.courses
+    }
+
+    retrieveCtx, retrieveSpan := startSpan(ctx, "retrieve")
+    retrieveStart := time.Now()
+    documents, err := bot.retrieve(retrieveCtx, collectionToQuery, question)
+    metrics.stageSeconds.Observe(time.Since(retrieveStart).Seconds(), stageRetrieval)
+    if err != nil {
+        retrieveSpan.End(err)
+        return "", err
+    }
+    all := documents
+    documents = relevantDocuments(documents, bot.retrieval.MaxDistance)
+    source := sourceVector
+    collection := localCollection
+    if collectionToQuery == nil || bot.Degraded() != nil {
+        source = sourceLocal
+    } else {
+        collection = collectionToQuery.Name
+        if store.documents != nil {
+            collection += ", " + store.documents.Name
+        }
     }
+    metrics.recordRetrieval(source, len(documents))
+    details.retrieved(collection, all, documents)
+    details.addFilter("distance at most %.2f", bot.retrieval.MaxDistance)
+    retrieved := len(all)
+    retrieveSpan.SetAttributes(slog.Int("retrieved", retrieved), slog.Int("relevant", len(documents)), slog.Bool("degraded", bot.Degraded() != nil))
+    retrieveSpan.End(nil)
+    slog.DebugContext(ctx, "Retrieved documents", "retrieved", retrieved, "relevant", len(documents), "degraded", bot.Degraded() != nil)
 
-    documents := Query(bot.chromaCtx, bot.chromaClient, collectionToQuery, question)
+    // Questions like "what's happening right now?" are answered from the schedule times
+    timeNote := bot.timeContext(ctx, question)
 
-    var preamble string
-    if len(documents) > 0 {
-        preamble = "Based on the available information, here are the relevant matches:\n\n"
-        for _, doc := range documents {
-            preamble += fmt.Sprintf("- %s\n", strings.Join(doc, " "))
+    // Standalone questions about the schedule may reuse an earlier answer. Answers that
+    // depend on the conversation or on the current time are never cached.
+    cacheable := bot.answers != nil && len(documents) > 0 && timeNote == "" && !session.hasHistory() && !answerCacheBypassed(ctx)
+
+    _, promptSpan := startSpan(ctx, "assemble_prompt", slog.String("prompts", bot.prompts.Version()))
+    data := bot.promptData(session, question, documents, timeNote)
+    promptName := promptContext
+    if len(documents) == 0 && timeNote == "" {
+        if !session.hasHistory() {
+            // Nothing relevant and no earlier turns to draw on, so don't let the model guess
+            promptSpan.End(nil)
+            slog.DebugContext(ctx, "Nothing relevant to the question")
+            details.setRoute(routeNotInSchedule)
+            return session.reply(notInScheduleAnswer()), nil
         }
-        preamble += "\nPlease use this information to answer the user's question."
-    } else {
-        preamble = "Provide accurate information based on the context of university courses and instructors."
+        promptName = promptNoMatch
+    }
+    system, err := bot.prompts.Render(promptSystem, data)
+    if err != nil {
+        promptSpan.End(err)
+        return "", err
+    }
+    preamble, err := bot.prompts.Render(promptName, data)
+    if err != nil {
+        promptSpan.End(err)
+        return "", err
     }
+    session.messages[0].Content = system
 
-    bot.context = append(bot.context, openai.ChatCompletionMessage{
-        Role:    openai.ChatMessageRoleAssistant,
-        Content: preamble,
-    })
+    // Retrieved context is shown for this turn only; at most a summary of it is kept
+    var summary string
+    if bot.retrieval.KeepSummary && len(documents) > 0 {
+        if summary, err = bot.prompts.Render(promptSummary, data); err != nil {
+            promptSpan.End(err)
+            return "", err
+        }
+    }
+    turnContext := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: preamble}
+    promptSpan.SetAttributes(slog.Int("documents", len(documents)), slog.Int("bytes", len(preamble)), slog.Bool("cacheable", cacheable))
+    promptSpan.End(nil)
+    slog.DebugContext(ctx, "Assembled prompt", "documents", len(documents), "bytes", len(preamble), "messages", len(session.messages)+1)
+
+    questionAt := len(session.messages) - 1
+    answer, err := bot.completeOrReuse(ctx, session, question, documents, turnContext, cacheable)
+    if err == nil && summary != "" {
+        session.messages = slices.Insert(session.messages, questionAt+1, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: summary})
+    }
+    return answer, err
+}
+
+// completeOrReuse completes the conversation with the turn's context, or reuses an
+// earlier answer to the same question for the same retrieval if cacheable. Answers that
+// called tools are not remembered. The caller holds session.mu.
+func (bot *ChatBot) completeOrReuse(ctx context.Context, session *Session, question string, documents []RetrievedDocument, turnContext openai.ChatCompletionMessage, cacheable bool) (string, error) {
+    if !cacheable {
+        return bot.complete(ctx, session, turnContext)
+    }
+    // Answers written by another model, from other prompts, or in another form, are not reused
+    fingerprint := contentHash(bot.Model() + ":" + bot.prompts.Version() + ":" + answerCacheMode(ctx) + ":" + retrievalFingerprint(documents))
+    vector := bot.questionVector(ctx, question)
+    if cached, ok := bot.answers.Lookup(fingerprint, question, vector, bot.clock.Now()); ok {
+        if answer, ok := fromCache(ctx, cached); ok {
+            slog.DebugContext(ctx, "Answered from cache", "fingerprint", fingerprint[:12])
+            answerDetailsFrom(ctx).setRoute(routeCache)
+            return session.reply(answer), nil
+        }
+    }
+    turnStart := len(session.messages)
+    answer, err := bot.complete(ctx, session, turnContext)
+    // Answers that used tools, such as web search, depend on more than the retrieval
+    if err == nil && !session.usedToolsSince(turnStart) {
+        bot.answers.Store(fingerprint, question, vector, toCache(ctx, answer), bot.clock.Now())
+    }
+    return answer, err
+}
+
+// questionVector embeds a question for near-duplicate matching in the answer cache, or
+// returns nil without a vector store. The embedding is usually already cached from
+// retrieval.
+func (bot *ChatBot) questionVector(ctx context.Context, question string) []float32 {
+    courses := bot.vectorStore().courses
+    if courses == nil || courses.EmbeddingFunction == nil || bot.Degraded() != nil {
+        return nil
+    }
+    ctx, cancel := withTimeout(ctx, bot.timeouts.Retrieval)
+    defer cancel()
+    embedding, err := courses.EmbeddingFunction.EmbedQuery(ctx, question)
+    if err != nil || embedding == nil || embedding.ArrayOfFloat32 == nil {
+        return nil
+    }
+    return *embedding.ArrayOfFloat32
+}
+
+// retrieve looks up documents for the question in collection and in the ingested pages.
+// Without a vector store, or when it fails or exceeds the retrieval timeout, it falls
+// back to structured matching over the course data and records the failure so callers
+// can report the degraded state. It only fails if ctx itself is cancelled.
+func (bot *ChatBot) retrieve(ctx context.Context, collection *chroma.Collection, question string) ([]RetrievedDocument, error) {
+    limit := bot.retrieval.QuestionResults
+    if collection == nil {
+        return localRetrieve(question, bot.metadata.courses, limit), nil
+    }
+
+    documents, err := bot.query(ctx, collection, question, limit)
+    if err != nil {
+        if ctx.Err() != nil {
+            return nil, ctx.Err()
+        }
+        slog.WarnContext(ctx, "Falling back to in-process course data", "err", err)
+        bot.SetDegraded(err)
+        return localRetrieve(question, bot.metadata.courses, limit), nil
+    }
+    bot.SetDegraded(nil)
+
+    if documentCollection := bot.vectorStore().documents; documentCollection != nil {
+        // Merge in chunks of university pages so both sources compete on distance
+        pages, err := bot.query(ctx, documentCollection, question, limit)
+        if err != nil {
+            if ctx.Err() != nil {
+                return nil, ctx.Err()
+            }
+            slog.WarnContext(ctx, "Skipping university pages", "err", err)
+        } else {
+            documents = mergeDocuments(documents, pages, limit)
+        }
+    }
+    return documents, nil
+}
+
+// query runs one vector store query within the retrieval timeout.
+func (bot *ChatBot) query(ctx context.Context, collection *chroma.Collection, question string, limit int) ([]RetrievedDocument, error) {
+    ctx, cancel := withTimeout(ctx, bot.timeouts.Retrieval)
+    defer cancel()
+    ctx, span := startSpan(ctx, "query", slog.String("collection", collection.Name))
+    documents, err := Query(ctx, bot.vectorStore().client, collection, question, limit)
+    span.SetAttributes(slog.Int("documents", len(documents)))
+    span.End(err)
+    return documents, err
+}
 
-    req := openai.ChatCompletionRequest{
-        Model:    openai.GPT4oMini,
-        Messages: bot.context,
+// complete sends the conversation to the LLM with turnContext after the question,
+// running any tool calls it makes, and records the final reply in the conversation.
+// turnContext itself is not recorded. The caller holds session.mu.
+func (bot *ChatBot) complete(ctx context.Context, session *Session, turnContext openai.ChatCompletionMessage) (string, error) {
+    questionAt := len(session.messages) - 1
+    // Offer tools in name order so identical conversations produce identical requests
+    names := make([]string, 0, len(bot.tools))
+    for name := range bot.tools {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    var tools []openai.Tool
+    for _, name := range names {
+        definition := bot.tools[name].definition
+        tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &definition})
     }
 
-    response, err := bot.llmClient.client.CreateChatCompletion(context.Background(), req)
+    for round := 0; round <= maxToolRounds; round++ {
+        // Over budget, answer with a cheaper model or not at all
+        model, err := bot.usage.Model(session.ID, bot.llmClient.model, bot.clock.Now())
+        if err != nil {
+            return "", err
+        }
+        req := openai.ChatCompletionRequest{
+            Model:    model,
+            Messages: slices.Insert(slices.Clone(session.messages), questionAt+1, turnContext),
+        }
+        // Stop offering tools on the last round so the model has to answer
+        if round < maxToolRounds {
+            req.Tools = tools
+        }
+        structured := structuredAnswerFrom(ctx)
+        if structured != nil {
+            req.ResponseFormat = answerFormat
+        }
+
+        completionCtx, cancel := withTimeout(ctx, bot.timeouts.Completion)
+        completionCtx, span := startSpan(completionCtx, "complete", slog.String("model", model), slog.Int("round", round))
+        started := time.Now()
+        response, err := bot.llmClient.client.CreateChatCompletion(completionCtx, req)
+        cancel()
+        metrics.stageSeconds.Observe(time.Since(started).Seconds(), stageCompletion)
+        if err != nil {
+            metrics.recordLLMError(err)
+            span.End(err)
+            return "", fmt.Errorf("ChatCompletion failed: %w", err)
+        }
+        recordCompletionUsage(ctx, model, response.Usage)
+        answerDetailsFrom(ctx).requested(req, response.Usage)
+        span.SetAttributes(slog.Int("prompt_tokens", response.Usage.PromptTokens), slog.Int("completion_tokens", response.Usage.CompletionTokens))
+        span.End(nil)
+        slog.DebugContext(ctx, "Completed", "model", model, "round", round, "prompt_tokens", response.Usage.PromptTokens,
+            "completion_tokens", response.Usage.CompletionTokens, "duration", time.Since(started))
+        if len(response.Choices) == 0 {
+            return "", fmt.Errorf("no response from LLM")
+        }
+
+        message := response.Choices[0].Message
+        if len(message.ToolCalls) == 0 && structured != nil {
+            // Keep just the text in the conversation
+            message.Content = bot.parseStructuredReply(ctx, message, structured)
+            message.Refusal = ""
+        }
+        session.add(message)
+        if len(message.ToolCalls) == 0 {
+            return message.Content, nil
+        }
+
+        for _, call := range message.ToolCalls {
+            // Rounds that read web search results count towards web search
+            if call.Function.Name == WebSearchTool().Name {
+                ctx = withUsageFeature(ctx, featureWebSearch)
+            }
+            session.add(openai.ChatCompletionMessage{
+                Role:       openai.ChatMessageRoleTool,
+                Content:    bot.runTool(ctx, call),
+                ToolCallID: call.ID,
+            })
+        }
+    }
+
+    return "", fmt.Errorf("no response from LLM after %d tool rounds", maxToolRounds)
+}
+
+// runTool dispatches a tool call to its handler. Failures are reported back to the
+// model as the tool result so it can recover.
+func (bot *ChatBot) runTool(ctx context.Context, call openai.ToolCall) string {
+    tool, ok := bot.tools[call.Function.Name]
+    if !ok {
+        return fmt.Sprintf("Unknown tool %q.", call.Function.Name)
+    }
+    ctx, span := startSpan(ctx, "tool", slog.String("tool", call.Function.Name))
+    result, err := tool.handle(ctx, call.Function.Arguments)
+    span.End(err)
+    if err != nil {
+        slog.WarnContext(ctx, "Tool failed", "tool", call.Function.Name, "err", err)
+        return fmt.Sprintf("Tool %s failed: %v", call.Function.Name, err)
+    }
+    return result
+}
+
+// webSearch looks up real pages for query with the configured search provider.
+func (bot *ChatBot) webSearch(ctx context.Context, query string) (string, error) {
+    if bot.search == nil {
+        return "Web search is not configured, so I can't look up pages right now.", nil
+    }
+    ctx, cancel := withTimeout(ctx, bot.timeouts.Search)
+    defer cancel()
+    ctx, span := startSpan(ctx, "web_search")
+    started := time.Now()
+    results, err := bot.search.Search(ctx, query, webSearchResults)
+    metrics.stageSeconds.Observe(time.Since(started).Seconds(), stageWebSearch)
+    span.SetAttributes(slog.Int("results", len(results)))
+    span.End(err)
     if err != nil {
-        return "", fmt.Errorf("ChatCompletion failed: %w", err)
+        return "", fmt.Errorf("web search failed: %w", err)
+    }
+    if len(results) == 0 {
+        return fmt.Sprintf("I couldn't find any pages for '%s'.", query), nil
     }
+    return formatSearchResults(results), nil
+}
 
-    if len(response.Choices) > 0 {
-        reply := response.Choices[0].Message.Content
-        bot.context = append(bot.context, openai.ChatCompletionMessage{
-            Role:    openai.ChatMessageRoleAssistant,
-            Content: reply,
-        })
-        return reply, nil
+// handleWebSearch runs the web_search tool.
+func (bot *ChatBot) handleWebSearch(ctx context.Context, arguments string) (string, error) {
+    var args struct {
+        Query string `json:"query"`
     }
+    if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+        return "", fmt.Errorf("invalid arguments: %w", err)
+    }
+    return bot.webSearch(ctx, args.Query)
+}
 
-    return "", fmt.Errorf("no response from LLM")
+// catalogNote returns the catalog description and prerequisites for a retrieved
+// schedule row, or "" when there is no catalog or no matching entry.
+func (bot *ChatBot) catalogNote(doc RetrievedDocument) string {
+    if bot.catalog == nil {
+        return ""
+    }
+    var course Course
+    if err := json.Unmarshal([]byte(doc.Document), &course); err != nil {
+        return ""
+    }
+    entry, ok := bot.catalog.ForCourse(course)
+    if !ok {
+        return ""
+    }
+    note := fmt.Sprintf(" Catalog: %s (%s units).", entry.Description, entry.Units)
+    if len(entry.Prerequisites) > 0 {
+        note += " Prerequisites: " + strings.Join(entry.Prerequisites, ", ") + "."
+    }
+    if len(entry.Corequisites) > 0 {
+        note += " Corequisites: " + strings.Join(entry.Corequisites, ", ") + "."
+    }
+    return note
 }
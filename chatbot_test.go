@@ -1,18 +1,47 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
-	//"strings"
+	"strings"
 	"testing"
-	
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	"github.com/amikos-tech/chroma-go/types"
+	openai "github.com/sashabaranov/go-openai"
 )
 
-func RealChatBot() *ChatBot {
+// RealChatBot builds a chatbot on the real schedule, OpenAI and Chroma. Set
+// CATALOG_FIXTURES=record to save the exchanges under testdata/fixtures (or
+// $CATALOG_FIXTURES_DIR), and CATALOG_FIXTURES=replay to run from recorded fixtures
+// without network access or an API key. No fixtures are committed, so replaying skips
+// the test until a set has been recorded, as does running without an API key. With
+// fixtures, the embedding and answer caches are off, so every exchange is recorded and
+// replay does not depend on what a cache held while recording.
+func RealChatBot(t *testing.T) *ChatBot {
+    if os.Getenv("CATALOG_FIXTURES") == fixturesReplay {
+        if _, err := os.Stat(fixturesDir()); err != nil {
+            t.Skipf("No fixtures to replay in %s; record them with CATALOG_FIXTURES=record", fixturesDir())
+        }
+    }
+    transport := httpTransport
+    t.Cleanup(func() { httpTransport = transport })
+    mode, err := useFixturesFromEnv()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if mode == fixturesReplay && os.Getenv("OPENAI_PROJECT_KEY") == "" {
+        t.Setenv("OPENAI_PROJECT_KEY", replayAPIKey)
+    }
     apiKey := os.Getenv("OPENAI_PROJECT_KEY")
     if apiKey == "" {
-        log.Fatal("API key is missing. Please set OPENAI_PROJECT_KEY environment variable.")
+        t.Skip("Set OPENAI_PROJECT_KEY, or CATALOG_FIXTURES=replay with recorded fixtures, to run against the real API")
     }
 
     llmClient := NewLLMClient(apiKey)
@@ -21,24 +50,34 @@ func RealChatBot() *ChatBot {
     csvFilePath := "Fall 2024 Class Schedule 08082024.csv"
     csvFile, err := os.Open(csvFilePath)
     if err != nil {
-        log.Fatalf("Failed to open CSV file: %v", err)
+        t.Fatalf("Failed to open CSV file: %v", err)
     }
     defer csvFile.Close()
 
     courses, err := ReadCSV(csvFile)
     if err != nil {
-        log.Fatalf("Failed to read CSV file: %v", err)
+        t.Fatalf("Failed to read CSV file: %v", err)
     }
-    fmt.Printf("Loaded %d courses from CSV.\n", len(courses))
+    t.Logf("Loaded %d courses from CSV.", len(courses))
 
     // Initialize MetadataExtractor
     metadataExtractor := &MetadataExtractor{courses: courses}
 
     // Add courses and instructors to ChromaDB
-    chromaCtx, chromaClient, courseCollection, instructorCollection := Add(metadataExtractor.courses)
+    cfg, err := LoadConfig("")
+    if err != nil {
+        t.Fatalf("Failed to load config: %v", err)
+    }
+    if mode != "" {
+        cfg.Embedding.CachePath = ""
+    }
+    chromaClient, courseCollection, instructorCollection, err := Add(context.Background(), cfg, metadataExtractor.courses)
+    if err != nil {
+        t.Fatalf("Failed to add courses to ChromaDB: %v", err)
+    }
 
-    // Return the chatbot
-    return NewChatBot(llmClient, metadataExtractor, chromaCtx, chromaClient, courseCollection, instructorCollection)
+    // Return the chatbot; NewChatBot leaves the answer cache off
+    return NewChatBot(llmClient, metadataExtractor, chromaClient, courseCollection, instructorCollection)
 }
 
 
@@ -52,29 +91,29 @@ func TestCanonicalName(t *testing.T) {
 }
 
 func TestContext(t *testing.T) {
-	chatbot := RealChatBot()
+	chatbot := RealChatBot(t)
 
 	// First question: Who is teaching CS 272?
 	question1 := "Who is teaching CS 272?"
-	answer1, _:= chatbot.AnswerQuestion(question1)
+	answer1, _:= chatbot.AnswerQuestion(context.Background(), question1)
 	fmt.Printf("Answer for question '%s':\n%s\n", question1, answer1)
 
 	// Second question: What's his email address?
 	question2 := "What's his email address?"
-	answer2, _ := chatbot.AnswerQuestion(question2)
+	answer2, _ := chatbot.AnswerQuestion(context.Background(), question2)
 	fmt.Printf("Answer for question '%s':\n%s\n", question2, answer2)
 }
 
 func TestMultiple(t *testing.T) {
-	chatbot := RealChatBot()
+	chatbot := RealChatBot(t)
 
 	fmt.Printf("What CS courses are Phil Peterson and Greg Benson teaching?\n")
 	// Question: What CS courses are Phil Peterson and Greg Benson teaching?
 	question1 := "What CS courses is Phil Peterson teaching?"
-	answer1, _ := chatbot.AnswerQuestion(question1)
+	answer1, _ := chatbot.AnswerQuestion(context.Background(), question1)
 
 	question2 := "What CS courses is Greg Benson teaching?"
-	answer2, _ := chatbot.AnswerQuestion(question2)
+	answer2, _ := chatbot.AnswerQuestion(context.Background(), question2)
 
 	// Print the response
 	fmt.Printf("Answer for question '%s':\n%s\n", answer1, answer2)
@@ -83,10 +122,190 @@ func TestMultiple(t *testing.T) {
 
 // TestLocation tests queries with location constraints
 func TestLocation(t *testing.T) {
-	chatbot := RealChatBot()
+	chatbot := RealChatBot(t)
 
 	question := "What CS course is Phil Peterson teaching in LS G12?"
-	answer, _  := chatbot.AnswerQuestion(question)
+	answer, _  := chatbot.AnswerQuestion(context.Background(), question)
 
 	fmt.Printf("Answer for question '%s':\n%s\n", question, answer)
 }
+
+func TestClarifyCourseNumber(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272"},
+		{Subject: "CS", CourseNumber: "274"},
+		{Subject: "CS", CourseNumber: "315"},
+	}
+
+	if reply := clarifyQuestion("Who teaches CS 272?", courses, nil); reply != "" {
+		t.Errorf("Expected no clarification for an offered course, got '%s'", reply)
+	}
+
+	reply := clarifyQuestion("Who teaches cs 273?", courses, nil)
+	if reply != "Did you mean CS 272 or CS 274?" {
+		t.Errorf("Expected a clarifying question, got '%s'", reply)
+	}
+
+	reply = clarifyQuestion("Is CS 999 offered?", courses, nil)
+	if !strings.Contains(reply, "not in the "+scheduleTerm+" schedule") {
+		t.Errorf("Expected a not-in-schedule reply, got '%s'", reply)
+	}
+}
+
+func TestClarifyInstructor(t *testing.T) {
+	instructors := InitializeInstructors()
+
+	reply := clarifyQuestion("What is Phil teaching?", nil, instructors)
+	if reply != "Did you mean Philip Peterson or Philip Choong?" {
+		t.Errorf("Expected a clarifying question, got '%s'", reply)
+	}
+
+	if reply := clarifyQuestion("What is Phil Peterson teaching?", nil, instructors); reply != "" {
+		t.Errorf("Expected no clarification for a full name, got '%s'", reply)
+	}
+}
+
+func TestRelevantDocuments(t *testing.T) {
+	documents := []RetrievedDocument{
+		{ID: "1", Distance: 0.2},
+		{ID: "2", Distance: 0.9},
+	}
+
+	relevant := relevantDocuments(documents, defaultMaxDistance)
+	if len(relevant) != 1 || relevant[0].ID != "1" {
+		t.Errorf("Expected only document 1 to be relevant, got %v", relevant)
+	}
+}
+
+func TestInstructorProfile(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "315", Section: "01", CRN: "41001", Title: "Computer Architecture", MeetDays: "MW", Building: "LS", ActualEnrollment: "30",
+			InstructorFirstName: "Greg", InstructorLastName: "Benson", InstructorEmail: "benson@usfca.edu"},
+		{Subject: "CS", CourseNumber: "315L", Section: "01", CRN: "41002", Title: "Computer Architecture Lab", MeetDays: "F", Building: "HR", ActualEnrollment: "28",
+			InstructorFirstName: "Gregory", InstructorLastName: "Benson", InstructorEmail: "benson@usfca.edu"},
+		// A second meeting row of the same section must not be counted twice
+		{Subject: "CS", CourseNumber: "315L", Section: "01", CRN: "41002", Title: "Computer Architecture Lab", MeetDays: "T", Building: "HR", ActualEnrollment: "28",
+			InstructorFirstName: "Gregory", InstructorLastName: "Benson", InstructorEmail: "benson@usfca.edu"},
+	}
+	chatbot := NewChatBot(nil, &MetadataExtractor{courses: courses}, nil, nil, nil)
+
+	profile, ok := chatbot.InstructorProfile("greg benson")
+	if !ok {
+		t.Fatal("Expected a profile for Greg Benson")
+	}
+	if profile.Name != "Gregory Benson" || len(profile.Courses) != 2 || profile.TotalEnrollment != 58 {
+		t.Errorf("Expected 2 courses and 58 students for Gregory Benson, got %+v", profile)
+	}
+	if strings.Join(profile.MeetDays, "") != "MTWF" || strings.Join(profile.Buildings, ",") != "HR,LS" {
+		t.Errorf("Expected days MTWF in HR and LS, got %v in %v", profile.MeetDays, profile.Buildings)
+	}
+
+	if _, ok := chatbot.InstructorProfile("teaches CS 315"); ok {
+		t.Error("Expected no profile for a question that is not a name")
+	}
+}
+
+func TestAddInstructorProfilesReplacesStale(t *testing.T) {
+	var upserted []string
+	var deletes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IDs       []string                 `json:"ids"`
+			Where     json.RawMessage          `json:"where"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/upsert"):
+			upserted = append(upserted, body.IDs...)
+			w.Write([]byte("true"))
+		case strings.HasSuffix(r.URL.Path, "/delete"):
+			deletes = append(deletes, string(body.Where))
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client, err := chroma.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := chroma.NewCollection(client.ApiClient, "id", "instructors-collection", nil, constantEmbedder{}, types.DefaultTenant, types.DefaultDatabase)
+
+	// Profiles are stored on every call, under the same names the course metadata uses
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", InstructorFirstName: "Phil", InstructorLastName: "Peterson"},
+		{Subject: "MATH", CourseNumber: "109", CRN: "2", InstructorFirstName: "Julia", InstructorLastName: "Nolfo"},
+	}
+	for range 2 {
+		if err := addInstructorProfiles(context.Background(), collection, courses); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(upserted, ",") != "Julia Nolfo,Philip Peterson,Julia Nolfo,Philip Peterson" {
+		t.Errorf("Expected the profiles to be stored twice, got %v", upserted)
+	}
+	if name := instructorName(courses[0]); name != "Philip Peterson" {
+		t.Errorf("Expected courses to be stored under 'Philip Peterson', got '%s'", name)
+	}
+
+	// Profiles of instructors no longer in the schedule are deleted
+	want := `{"$and":[{"kind":"instructor_profile"},{"instructor_canonical_name":{"$nin":["Julia Nolfo","Philip Peterson"]}}]}`
+	if len(deletes) != 2 || deletes[1] != want {
+		t.Errorf("Unexpected deletes:\n%s", strings.Join(deletes, "\n"))
+	}
+}
+
+// newStandInLLM returns an LLM client whose requests are served by handler.
+func newStandInLLM(t *testing.T, handler http.HandlerFunc) *LLMClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := openai.DefaultConfig("sk-test")
+	config.BaseURL = server.URL + "/v1"
+	return &LLMClient{client: openai.NewClientWithConfig(config), model: openai.GPT4oMini}
+}
+
+// completionRequest is a chat completion request as a stand-in model reads it. The
+// response format is kept raw, as its schema cannot be decoded into the client's type.
+type completionRequest struct {
+	openai.ChatCompletionRequest
+	ResponseFormat json.RawMessage `json:"response_format"`
+}
+
+// decodeCompletionRequest reads the chat completion request sent to a stand-in model.
+func decodeCompletionRequest(r *http.Request) (completionRequest, error) {
+	var req completionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	return req, err
+}
+
+func TestAnswerQuestionTimeout(t *testing.T) {
+	// The stand-in model answers far too late, so the completion timeout ends the request.
+	llm := newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	chatbot := NewChatBot(llm, &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetTimeouts(TimeoutConfig{Completion: 50 * time.Millisecond})
+
+	_, err := chatbot.AnswerQuestion(context.Background(), "Who teaches CS 272?")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the completion to time out, got %v", err)
+	}
+	if messages := chatbot.Session().Messages(); len(messages) != 1 {
+		t.Errorf("Expected the failed turn to be dropped, got %d messages", len(messages))
+	}
+
+	// Cancelling the caller's context abandons the question the same way.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := chatbot.AnswerQuestion(ctx, "Who teaches CS 272?"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled question, got %v", err)
+	}
+}
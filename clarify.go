@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scheduleTerm names the term covered by the loaded schedule.
+const scheduleTerm = "Fall 2024"
+
+// defaultMaxDistance is the largest embedding distance at which a retrieved document
+// is still treated as relevant to the question.
+const defaultMaxDistance = 0.5
+
+// maxSuggestions caps how many alternatives a clarifying question offers.
+const maxSuggestions = 3
+
+// courseCodePattern matches course references like "CS 272", "cs272" or "MATH-109L".
+var courseCodePattern = regexp.MustCompile(`(?i)\b([a-z&]{2,5})\s?-?(\d{2,3}[a-z]?)\b`)
+
+// notInScheduleAnswer is the reply given when nothing in the schedule matches the question.
+func notInScheduleAnswer() string {
+	return fmt.Sprintf("I couldn't find anything matching that in the %s schedule. It may not be offered this term.", scheduleTerm)
+}
+
+// clarifyQuestion checks the question for course codes or instructor names that do not
+// resolve to a single entry in the schedule. It returns a clarifying question or an
+// explicit "not in this term's schedule" reply, or "" when the question is unambiguous.
+func clarifyQuestion(question string, courses []Course, instructors []Instructor) string {
+	if reply := clarifyCourseCodes(question, courses); reply != "" {
+		return reply
+	}
+	return clarifyInstructors(question, instructors)
+}
+
+// clarifyCourseCodes looks for course codes whose subject exists but whose number is not
+// offered, suggesting the nearest offered numbers in that subject.
+func clarifyCourseCodes(question string, courses []Course) string {
+	numbersBySubject := make(map[string]map[string]bool)
+	for _, course := range courses {
+		subject := strings.ToUpper(course.Subject)
+		if numbersBySubject[subject] == nil {
+			numbersBySubject[subject] = make(map[string]bool)
+		}
+		numbersBySubject[subject][strings.ToUpper(course.CourseNumber)] = true
+	}
+
+	for _, match := range courseCodePattern.FindAllStringSubmatch(question, -1) {
+		subject := strings.ToUpper(match[1])
+		number := strings.ToUpper(match[2])
+		offered, ok := numbersBySubject[subject]
+		if !ok || offered[number] {
+			continue
+		}
+
+		suggestions := suggestCourseNumbers(number, offered)
+		if len(suggestions) == 0 {
+			return fmt.Sprintf("%s %s is not in the %s schedule.", subject, number, scheduleTerm)
+		}
+		for i, suggestion := range suggestions {
+			suggestions[i] = subject + " " + suggestion
+		}
+		return fmt.Sprintf("Did you mean %s?", joinAlternatives(suggestions))
+	}
+	return ""
+}
+
+// suggestCourseNumbers returns offered course numbers that start with the given number
+// or are numerically within a few of it, closest first.
+func suggestCourseNumbers(number string, offered map[string]bool) []string {
+	target, targetErr := strconv.Atoi(strings.TrimRight(number, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+
+	type candidate struct {
+		number   string
+		distance int
+	}
+	var candidates []candidate
+	for offeredNumber := range offered {
+		value, err := strconv.Atoi(strings.TrimRight(offeredNumber, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(offeredNumber, number):
+			candidates = append(candidates, candidate{offeredNumber, len(offeredNumber) - len(number)})
+		case targetErr == nil && absInt(value-target) <= 3:
+			candidates = append(candidates, candidate{offeredNumber, absInt(value - target)})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].number < candidates[j].number
+	})
+
+	var suggestions []string
+	for _, c := range candidates {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		suggestions = append(suggestions, c.number)
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// clarifyInstructors asks which instructor is meant when the question only gives a first
+// name shared by several instructors, e.g. "Phil".
+func clarifyInstructors(question string, instructors []Instructor) string {
+	lower := strings.ToLower(question)
+	for _, instructor := range instructors {
+		if containsWord(lower, strings.ToLower(instructor.CanonicalName)) {
+			return ""
+		}
+		for _, alias := range instructor.Aliases {
+			if containsWord(lower, strings.ToLower(alias)) {
+				return ""
+			}
+		}
+	}
+
+	var matches []string
+	for _, instructor := range instructors {
+		for _, alias := range instructor.Aliases {
+			firstName := strings.ToLower(strings.Fields(alias)[0])
+			if containsWord(lower, firstName) {
+				matches = append(matches, instructor.CanonicalName)
+				break
+			}
+		}
+	}
+	if len(matches) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("Did you mean %s?", joinAlternatives(matches))
+}
+
+// containsWord reports whether phrase appears in text on word boundaries.
+func containsWord(text, phrase string) bool {
+	pattern := `\b` + regexp.QuoteMeta(phrase) + `\b`
+	matched, _ := regexp.MatchString(pattern, text)
+	return matched
+}
+
+// joinAlternatives joins options as "A", "A or B" or "A, B or C".
+func joinAlternatives(options []string) string {
+	if len(options) == 1 {
+		return options[0]
+	}
+	return strings.Join(options[:len(options)-1], ", ") + " or " + options[len(options)-1]
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
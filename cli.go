@@ -0,0 +1,705 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// Store backends accepted by the --store flag.
+const (
+	storeChroma = "chroma" // ChromaDB vector store with OpenAI embeddings
+	storeMemory = "memory" // In-process structured matching, no embeddings
+)
+
+// usage describes the subcommands.
+const usage = `Usage: catalog <command> [flags]
+
+Commands:
+  chat          Interactive question answering (default; --debug traces each answer)
+  ask QUESTION  Answer a single question and exit (--debug traces how it was found)
+  serve         Answer questions over HTTP
+  ingest        Load the schedule (and --docs pages) into the vector store
+  reindex       Drop and rebuild the schedule collections
+  search        Filter sections, e.g. search --subject CS --days TR
+  instructors   List instructor profiles
+  export        Write the whole schedule
+  config print  Show the effective configuration with secrets redacted
+  cache stats   Show embedding cache entries per model
+  cache prune   Drop cached embeddings of other models than --model
+  eval FILE     Score answers to golden questions (Markdown report, or --format json)
+
+Common flags:
+  --config PATH    YAML config file (default $CATALOG_CONFIG or catalog.yaml)
+  --csv PATH       Course schedule CSV
+  --store NAME     Retrieval backend: chroma or memory
+  --model NAME     Chat model
+  --format NAME    Output format: text, json, table or csv
+  --color WHEN     Color tables: auto, always or never
+  --log-level NAME Log level: debug, info, warn or error
+  --trace PATH     Append OpenTelemetry JSON traces of each answer to PATH
+  --prompts DIR    Prompt templates replacing the built-in ones of the same name
+`
+
+// options holds the flags shared by every subcommand. Empty values leave the
+// configuration file and environment settings in place.
+type options struct {
+	configPath string
+	csvPath    string
+	store      string
+	model      string
+	format     string
+	logLevel   string
+	traceFile  string
+	promptsDir string
+	color      string
+}
+
+// newFlagSet creates a subcommand's flag set with the common flags registered.
+func newFlagSet(name string, opts *options, defaultFormat string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&opts.configPath, "config", "", "YAML config file")
+	flags.StringVar(&opts.csvPath, "csv", "", "course schedule CSV")
+	flags.StringVar(&opts.store, "store", "", "retrieval backend: chroma or memory")
+	flags.StringVar(&opts.model, "model", "", "chat model")
+	flags.StringVar(&opts.format, "format", defaultFormat, "output format: text, json, table or csv")
+	flags.StringVar(&opts.color, "color", colorAuto, "color tables: auto, always or never")
+	flags.StringVar(&opts.logLevel, "log-level", "", "log level: debug, info, warn or error")
+	flags.StringVar(&opts.traceFile, "trace", "", "append OpenTelemetry JSON traces of each answer to this file")
+	flags.StringVar(&opts.promptsDir, "prompts", "", "directory of prompt templates replacing the built-in ones")
+	return flags
+}
+
+// config loads the configuration, applies the flag overrides on top and validates it.
+func (opts *options) config() (*Config, error) {
+	cfg, err := opts.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// load loads the configuration and applies the flag overrides on top, without
+// validating the result.
+func (opts *options) load() (*Config, error) {
+	if !validFormat(opts.format) {
+		return nil, fmt.Errorf("unknown format %q: use text, json, table or csv", opts.format)
+	}
+	if opts.color != "" && opts.color != colorAuto && opts.color != colorAlways && opts.color != colorNever {
+		return nil, fmt.Errorf("unknown color setting %q: use auto, always or never", opts.color)
+	}
+	cfg, err := LoadConfig(opts.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.csvPath != "" {
+		cfg.Schedule.CSVPath = opts.csvPath
+	}
+	if opts.store != "" {
+		cfg.Store = opts.store
+	}
+	if opts.model != "" {
+		cfg.OpenAI.Model = opts.model
+	}
+	if opts.logLevel != "" {
+		cfg.Log.Level = opts.logLevel
+	}
+	if opts.traceFile != "" {
+		cfg.Log.TraceFile = opts.traceFile
+	}
+	if opts.promptsDir != "" {
+		cfg.Prompts.Dir = opts.promptsDir
+	}
+	return cfg, nil
+}
+
+// run dispatches the command line to a subcommand.
+func run(args []string, stdout io.Writer) error {
+	command := "chat"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "chat":
+		return runChat(args)
+	case "ask":
+		return runAsk(args, stdout)
+	case "serve":
+		return runServe(args)
+	case "ingest":
+		return runIngest(args, stdout)
+	case "reindex":
+		return runReindex(args, stdout)
+	case "search":
+		return runSearch(args, stdout)
+	case "instructors":
+		return runInstructors(args, stdout)
+	case "export":
+		return runExport(args, stdout)
+	case "config":
+		return runConfig(args, stdout)
+	case "cache":
+		return runCache(args, stdout)
+	case "eval":
+		return runEval(args, stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
+}
+
+// parseFlags parses a subcommand's flags and returns the resulting configuration.
+func parseFlags(flags *flag.FlagSet, opts *options, args []string) (*Config, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	cfg, err := opts.config()
+	if err != nil {
+		return nil, err
+	}
+	if err := setupLogging(cfg.Log, flags.Name() == "chat"); err != nil {
+		return nil, err
+	}
+	mode, err := useFixturesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if mode == fixturesReplay && cfg.OpenAI.APIKey == "" {
+		cfg.OpenAI.APIKey = replayAPIKey
+	}
+	return cfg, nil
+}
+
+// loadSchedule reads the configured course schedule.
+func loadSchedule(cfg *Config) (*MetadataExtractor, error) {
+	metadataExtractor, err := NewMetadataExtractor(cfg.Schedule.CSVPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize MetadataExtractor: %w", err)
+	}
+	return metadataExtractor, nil
+}
+
+// requireAPIKey checks that an OpenAI API key is configured.
+func requireAPIKey(cfg *Config) error {
+	if cfg.OpenAI.APIKey == "" {
+		return ErrMissingAPIKey
+	}
+	return nil
+}
+
+// interruptContext returns a context that is cancelled when the user presses Ctrl-C.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// connectStore adds the course and instructor data to the ChromaDB collections within the
+// store timeout, and opens the collection of ingested university pages if any have been
+// loaded. It fails only if the course collection could not be opened.
+func connectStore(ctx context.Context, cfg *Config, usage *UsageTracker, courses []Course) (vectorStore, error) {
+	ctx, cancel := withTimeout(ctx, cfg.Timeouts.Store)
+	defer cancel()
+	ctx = WithUsage(ctx, usage, systemClock{}, "", featureIngest)
+
+	chromaClient, courseCollection, instructorCollection, err := Add(ctx, cfg, courses)
+	if err != nil && courseCollection == nil {
+		return vectorStore{}, err
+	}
+	if err != nil {
+		slog.Warn("Some courses were not stored", "err", err)
+	}
+	store := vectorStore{client: chromaClient, courses: courseCollection, instructors: instructorCollection}
+
+	// Retrieve from ingested university pages as well, if any have been loaded.
+	documentCollection, err := OpenDocumentCollection(ctx, chromaClient, cfg)
+	if err != nil {
+		slog.Warn("Documents collection unavailable", "err", err)
+	} else if count, err := documentCollection.Count(ctx); err == nil && count > 0 {
+		store.documents = documentCollection
+	}
+	return store, nil
+}
+
+// buildChatBot assembles a chatbot from the schedule, the chosen store and the optional
+// catalog and search provider. Loading the store is limited by the store timeout.
+func buildChatBot(ctx context.Context, cfg *Config) (*ChatBot, error) {
+	if err := requireAPIKey(cfg); err != nil {
+		return nil, err
+	}
+	metadataExtractor, err := loadSchedule(cfg)
+	if err != nil {
+		return nil, err
+	}
+	prompts, err := LoadPrompts(cfg.Prompts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the LLM client using the API key.
+	llmClient := NewLLMClient(cfg.OpenAI.APIKey)
+	llmClient.SetModel(cfg.OpenAI.Model)
+
+	// Embedding the course data counts towards the daily budget as ingest usage.
+	usage := NewUsageTracker(cfg.Usage)
+
+	var chatbot *ChatBot
+	if cfg.Store == storeChroma {
+		connect := func(ctx context.Context) (vectorStore, error) {
+			return connectStore(ctx, cfg, usage, metadataExtractor.courses)
+		}
+		store, err := connect(ctx)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			// Keep answering from the in-process course data while the store is down,
+			// and try again as questions come in.
+			slog.Warn("Vector store unavailable, using in-process course data", "err", err)
+			chatbot = NewChatBot(llmClient, metadataExtractor, nil, nil, nil)
+			chatbot.SetDegraded(err)
+			chatbot.SetStoreConnector(connect)
+		} else {
+			chatbot = NewChatBot(llmClient, metadataExtractor, store.client, store.courses, store.instructors)
+			chatbot.SetDocumentCollection(store.documents)
+		}
+	} else {
+		chatbot = NewChatBot(llmClient, metadataExtractor, nil, nil, nil)
+	}
+	chatbot.SetRetrievalConfig(cfg.Retrieval)
+	chatbot.SetTimeouts(cfg.Timeouts)
+	chatbot.SetUsageTracker(usage)
+	chatbot.SetPrompts(prompts)
+	if cfg.Answers.TTL > 0 {
+		chatbot.SetAnswerCache(NewAnswerCache(cfg.Answers))
+	}
+
+	// Load catalog descriptions and prerequisites if a catalog file is configured.
+	if cfg.Schedule.CatalogPath != "" {
+		catalog, err := LoadCatalog(cfg.Schedule.CatalogPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load catalog: %w", err)
+		}
+		chatbot.SetCatalog(catalog)
+	}
+
+	// Set up web page search: a search endpoint if configured, otherwise a local site index.
+	searchProvider, err := newSearchProvider(cfg.Search)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize search provider: %w", err)
+	}
+	if searchProvider != nil {
+		chatbot.SetSearchProvider(searchProvider)
+	}
+
+	// Trace each answer to a file if asked; the caller closes it with the chatbot.
+	if cfg.Log.TraceFile != "" {
+		tracer, err := OpenTracer(cfg.Log.TraceFile)
+		if err != nil {
+			return nil, err
+		}
+		chatbot.SetTracer(tracer)
+	}
+	return chatbot, nil
+}
+
+// newSearchProvider builds the web search provider: an HTTP search endpoint if one is
+// configured, otherwise a local site index. It returns nil when neither is set.
+func newSearchProvider(cfg SearchConfig) (SearchProvider, error) {
+	if cfg.Endpoint != "" {
+		return NewHTTPSearchProvider(cfg.Endpoint, cfg.APIKey), nil
+	}
+	if cfg.SiteIndexDir != "" {
+		return NewSiteIndexProvider(cfg.SiteIndexDir, cfg.SiteBaseURL)
+	}
+	return nil, nil
+}
+
+// runChat starts the interactive REPL.
+func runChat(args []string) error {
+	var opts options
+	flags := newFlagSet("chat", &opts, formatText)
+	debug := flags.Bool("debug", false, "start with /debug on, tracing how each answer was found")
+	cfg, err := parseFlags(flags, &opts, args)
+	if err != nil {
+		return err
+	}
+
+	// Ctrl-C while loading gives up; once the REPL starts it cancels the current question.
+	ctx, stop := interruptContext()
+	chatbot, err := buildChatBot(ctx, cfg)
+	stop()
+	if err != nil {
+		return err
+	}
+	defer chatbot.Close()
+
+	fmt.Println("Entering interactive mode. Type your questions below:")
+	runInteractiveMode(chatbot, cfg.REPL, terminalStyle(os.Stdout, opts.color), *debug)
+	return nil
+}
+
+// runAsk answers one question and exits, for use in scripts.
+func runAsk(args []string, stdout io.Writer) error {
+	var opts options
+	flags := newFlagSet("ask", &opts, formatText)
+	debug := flags.Bool("debug", false, "follow the answer with a trace of how it was found")
+	cfg, err := parseFlags(flags, &opts, args)
+	if err != nil {
+		return err
+	}
+	question := strings.Join(flags.Args(), " ")
+	if strings.TrimSpace(question) == "" {
+		return errors.New("Usage: ask [flags] \"question\"")
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	chatbot, err := buildChatBot(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer chatbot.Close()
+	var details *AnswerDetails
+	if *debug {
+		ctx, details = WithAnswerDetails(ctx)
+	}
+	answer, err := chatbot.AnswerQuestionStructured(ctx, question)
+	if err != nil {
+		return fmt.Errorf("Error processing your question: %w", err)
+	}
+
+	switch opts.format {
+	case formatJSON:
+		return writeJSON(stdout, newAskResponse("", question, answer, details))
+	case formatCSV:
+		// The trace goes to standard error so the CSV stays parseable
+		if details != nil {
+			writeDebug(os.Stderr, details)
+		}
+		return writeCourseCSV(stdout, answer.Sections)
+	default:
+		if err := writeAnswer(stdout, answer, terminalStyle(stdout, opts.color)); err != nil || details == nil {
+			return err
+		}
+		return writeDebug(stdout, details)
+	}
+}
+
+// runServe answers questions over HTTP.
+func runServe(args []string) error {
+	var opts options
+	flags := newFlagSet("serve", &opts, formatJSON)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	cfg, err := parseFlags(flags, &opts, args)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	chatbot, err := buildChatBot(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer chatbot.Close()
+
+	// Each request is answered under its own context, so a client disconnecting cancels
+	// its question. Ctrl-C stops accepting requests and waits for those in flight.
+	sessions := NewSessionManager(chatbot, cfg.Sessions.IdleTimeout)
+	go sessions.Run(ctx)
+	httpServer := &http.Server{Addr: *addr, Handler: newServer(sessions)}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	slog.Info("Listening", "addr", *addr)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// runIngest loads the schedule and, with --docs, a directory of university pages into
+// the vector store.
+func runIngest(args []string, stdout io.Writer) error {
+	var opts options
+	flags := newFlagSet("ingest", &opts, formatText)
+	docsDir := flags.String("docs", "", "directory of HTML, Markdown or text pages to ingest")
+	cfg, err := parseFlags(flags, &opts, args)
+	if err != nil {
+		return err
+	}
+	if cfg.Store != storeChroma {
+		return errors.New("ingest needs --store chroma")
+	}
+	if err := requireAPIKey(cfg); err != nil {
+		return err
+	}
+	metadataExtractor, err := loadSchedule(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := withTimeout(ctx, cfg.Timeouts.Store)
+	defer cancel()
+	usage := NewUsageTracker(cfg.Usage)
+	ctx = WithUsage(ctx, usage, systemClock{}, "", featureIngest)
+
+	chromaClient, _, _, err := Add(ctx, cfg, metadataExtractor.courses)
+	if err != nil {
+		return fmt.Errorf("Failed to add courses: %w", err)
+	}
+	fmt.Fprintln(stdout, "Courses and instructors added to collections.")
+
+	if *docsDir != "" {
+		collection, err := OpenDocumentCollection(ctx, chromaClient, cfg)
+		if err != nil {
+			return fmt.Errorf("Failed to open documents collection: %w", err)
+		}
+		count, err := IngestDocuments(ctx, collection, *docsDir)
+		if err != nil {
+			return fmt.Errorf("Failed to ingest documents: %w", err)
+		}
+		fmt.Fprintf(stdout, "Ingested %d chunks from %s into %s.\n", count, *docsDir, cfg.Chroma.DocumentsCollection)
+	}
+	printEmbeddingCacheUse(stdout, cfg)
+	printEmbeddingUsage(stdout, usage)
+	return nil
+}
+
+// runReindex rebuilds the course and instructor collections from the schedule.
+func runReindex(args []string, stdout io.Writer) error {
+	var opts options
+	cfg, err := parseFlags(newFlagSet("reindex", &opts, formatText), &opts, args)
+	if err != nil {
+		return err
+	}
+	if cfg.Store != storeChroma {
+		return errors.New("reindex needs --store chroma")
+	}
+	if err := requireAPIKey(cfg); err != nil {
+		return err
+	}
+	metadataExtractor, err := loadSchedule(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx, cancel := withTimeout(ctx, cfg.Timeouts.Store)
+	defer cancel()
+	usage := NewUsageTracker(cfg.Usage)
+	ctx = WithUsage(ctx, usage, systemClock{}, "", featureIngest)
+
+	if _, _, _, err := Reindex(ctx, cfg, metadataExtractor.courses); err != nil {
+		return fmt.Errorf("Failed to rebuild collections: %w", err)
+	}
+	fmt.Fprintln(stdout, "Course and instructor collections rebuilt.")
+	printEmbeddingUsage(stdout, usage)
+	return nil
+}
+
+// runSearch filters the schedule by field without using the LLM.
+func runSearch(args []string, stdout io.Writer) error {
+	var opts options
+	var filter CourseFilter
+	flags := newFlagSet("search", &opts, formatTable)
+	flags.StringVar(&filter.Subject, "subject", "", "subject code, e.g. CS")
+	flags.StringVar(&filter.Number, "number", "", "course number, e.g. 272")
+	flags.StringVar(&filter.Days, "days", "", "meeting days that must all be included, e.g. TR")
+	flags.StringVar(&filter.Instructor, "instructor", "", "instructor name or alias")
+	flags.StringVar(&filter.Building, "building", "", "building code, e.g. LS")
+	flags.StringVar(&filter.Title, "title", "", "word or phrase in the title")
+	cfg, err := parseFlags(flags, &opts, args)
+	if err != nil {
+		return err
+	}
+	metadataExtractor, err := loadSchedule(cfg)
+	if err != nil {
+		return err
+	}
+	return writeCourses(stdout, FilterCourses(metadataExtractor.courses, filter), opts.format, terminalStyle(stdout, opts.color))
+}
+
+// runInstructors lists every instructor's profile.
+func runInstructors(args []string, stdout io.Writer) error {
+	var opts options
+	cfg, err := parseFlags(newFlagSet("instructors", &opts, formatTable), &opts, args)
+	if err != nil {
+		return err
+	}
+	metadataExtractor, err := loadSchedule(cfg)
+	if err != nil {
+		return err
+	}
+	return writeProfiles(stdout, BuildInstructorProfiles(metadataExtractor.courses), opts.format)
+}
+
+// runExport writes the whole schedule.
+func runExport(args []string, stdout io.Writer) error {
+	var opts options
+	cfg, err := parseFlags(newFlagSet("export", &opts, formatJSON), &opts, args)
+	if err != nil {
+		return err
+	}
+	metadataExtractor, err := loadSchedule(cfg)
+	if err != nil {
+		return err
+	}
+	return writeCourses(stdout, metadataExtractor.courses, opts.format, terminalStyle(stdout, opts.color))
+}
+
+// runConfig handles "config print", which shows the effective configuration.
+func runConfig(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("Usage: config print [flags]")
+	}
+	var opts options
+	if err := newFlagSet("config print", &opts, formatText).Parse(args[1:]); err != nil {
+		return err
+	}
+	// Print even an invalid configuration, as it shows where a bad setting came from,
+	// and report what is wrong with it after
+	cfg, err := opts.load()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Print(stdout); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+// runCache handles "cache stats" and "cache prune" for the embedding cache.
+func runCache(args []string, stdout io.Writer) error {
+	if len(args) == 0 || (args[0] != "stats" && args[0] != "prune") {
+		return errors.New("Usage: cache stats|prune [flags]")
+	}
+	var opts options
+	keepModel := ""
+	flags := newFlagSet("cache "+args[0], &opts, formatText)
+	if args[0] == "prune" {
+		flags.StringVar(&keepModel, "keep", "", "embedding model whose entries are kept (default the configured model)")
+	}
+	cfg, err := parseFlags(flags, &opts, args[1:])
+	if err != nil {
+		return err
+	}
+	if cfg.Embedding.CachePath == "" {
+		return errors.New("no embedding cache is configured (embedding.cache_path)")
+	}
+	cache, err := OpenEmbeddingCache(cfg.Embedding.CachePath)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "prune" {
+		if keepModel == "" {
+			keepModel = cfg.Embedding.Model
+		}
+		removed, err := cache.Prune(keepModel)
+		if err != nil {
+			return fmt.Errorf("Failed to prune embedding cache: %w", err)
+		}
+		fmt.Fprintf(stdout, "Removed %d cached embeddings; kept those for %s.\n", removed, keepModel)
+		return nil
+	}
+
+	stats := cache.Stats()
+	if opts.format == formatJSON {
+		return writeJSON(stdout, stats.Entries)
+	}
+	fmt.Fprintf(stdout, "Embedding cache %s:\n", cfg.Embedding.CachePath)
+	if len(stats.Entries) == 0 {
+		fmt.Fprintln(stdout, "  (empty)")
+	}
+	for _, model := range sortedKeys(stats.Entries) {
+		fmt.Fprintf(stdout, "  %s: %d entries\n", model, stats.Entries[model])
+	}
+	return nil
+}
+
+// printEmbeddingCacheUse reports how many embeddings this run took from the cache.
+func printEmbeddingCacheUse(stdout io.Writer, cfg *Config) {
+	if cfg.Embedding.CachePath == "" {
+		return
+	}
+	cache, err := sharedEmbeddingCache(cfg.Embedding.CachePath)
+	if err != nil {
+		return
+	}
+	stats := cache.Stats()
+	fmt.Fprintf(stdout, "Embedding cache: %d hits, %d misses.\n", stats.Hits, stats.Misses)
+}
+
+// printEmbeddingUsage reports the estimated tokens and cost of the embeddings computed.
+func printEmbeddingUsage(stdout io.Writer, usage *UsageTracker) {
+	total := usage.Stats().Total
+	if total.Calls == 0 {
+		return
+	}
+	fmt.Fprintf(stdout, "Embedded about %d tokens in %d calls (about $%.4f).\n", total.PromptTokens, total.Calls, total.Cost)
+}
+
+// runEval answers a file of golden questions and reports how well the answers and the
+// retrieval behind them match the expected facts.
+func runEval(args []string, stdout io.Writer) error {
+	var opts options
+	flags := newFlagSet("eval", &opts, formatText)
+	k := flags.Int("k", 5, "retrieved documents considered for recall@k")
+	out := flags.String("out", "", "write the report to this file instead of standard output")
+	cfg, err := parseFlags(flags, &opts, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("Usage: eval [flags] QUESTIONS.yaml")
+	}
+	suite, err := LoadEvalSuite(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	chatbot, err := buildChatBot(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer chatbot.Close()
+	report, err := RunEval(ctx, chatbot, suite, *k)
+	if err != nil {
+		return err
+	}
+
+	w := stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("Failed to create report: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if opts.format == formatJSON {
+		return writeJSON(w, report)
+	}
+	return writeEvalMarkdown(w, report)
+}
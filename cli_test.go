@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSearchCommand(t *testing.T) {
+	var out bytes.Buffer
+	err := run([]string{"search", "--subject", "CS", "--number", "272", "--days", "TR", "--format", "json"}, &out)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+
+	var courses []Course
+	if err := json.Unmarshal(out.Bytes(), &courses); err != nil {
+		t.Fatalf("Expected JSON output, got %v:\n%s", err, out.String())
+	}
+	if len(courses) == 0 {
+		t.Fatal("Expected CS 272 sections meeting Tuesday and Thursday")
+	}
+	for _, course := range courses {
+		if course.Subject != "CS" || course.CourseNumber != "272" || !strings.Contains(course.MeetDays, "T") || !strings.Contains(course.MeetDays, "R") {
+			t.Errorf("Unexpected section %+v", course)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if err := run([]string{"search", "--format", "yaml"}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+	if err := run([]string{"frobnicate"}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an unknown command to be rejected")
+	}
+}
+
+func TestLocalRetrieve(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+		{Subject: "CS", CourseNumber: "315", CRN: "2", Title: "Computer Architecture", InstructorFirstName: "Gregory", InstructorLastName: "Benson"},
+		{Subject: "MATH", CourseNumber: "109", CRN: "3", Title: "Calculus"},
+	}
+
+	documents := localRetrieve("Who teaches CS 315?", courses, 10)
+	if len(documents) != 1 || documents[0].ID != "2" {
+		t.Errorf("Expected only CS 315, got %v", documents)
+	}
+
+	documents = localRetrieve("What CS courses is Philip Peterson teaching?", courses, 10)
+	if len(documents) != 2 || documents[0].ID != "1" {
+		t.Errorf("Expected Peterson's course first among CS courses, got %v", documents)
+	}
+}
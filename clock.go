@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Clock tells the chatbot what time it is, so time-relative questions can be tested.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the current time in the campus time zone.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now().In(campusLocation)
+}
+
+// fixedClock always reports the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// campusLocation is the time zone the schedule's meeting times are written in.
+var campusLocation = loadCampusLocation()
+
+func loadCampusLocation() *time.Location {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+// TimeWindow is a span of time on one calendar day.
+type TimeWindow struct {
+	Date  time.Time // Midnight at the start of the day
+	Start int       // Minutes after midnight
+	End   int
+	Label string // How the window was described, e.g. "right now"
+}
+
+// Day returns the schedule day code (M, T, W, R, F, S or U) of the window's date.
+func (w TimeWindow) Day() byte {
+	return "UMTWRFS"[w.Date.Weekday()]
+}
+
+// String describes the window, e.g. "Tuesday, Oct 22 2:00 PM-5:00 PM".
+func (w TimeWindow) String() string {
+	return fmt.Sprintf("%s %s-%s", w.Date.Format("Monday, Jan 2 2006"), formatClock(w.Start), formatClock(w.End))
+}
+
+var (
+	afterPattern   = regexp.MustCompile(`\bafter\s+(\d{1,2}(?::\d{2})?\s*(?:am|pm)?|noon)\b`)
+	beforePattern  = regexp.MustCompile(`\bbefore\s+(\d{1,2}(?::\d{2})?\s*(?:am|pm)?|noon)\b`)
+	betweenPattern = regexp.MustCompile(`\b(?:between|from)\s+(\d{1,2}(?::\d{2})?\s*(?:am|pm)?)\s+(?:and|to|-)\s+(\d{1,2}(?::\d{2})?\s*(?:am|pm)?)\b`)
+	atPattern      = regexp.MustCompile(`\bat\s+(\d{1,2}(?::\d{2})?\s*(?:am|pm)|noon)\b`)
+	weekdayPattern = regexp.MustCompile(`\b(next|this)\s+(monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+)
+
+// ParseTimeWindow finds a relative time expression in the question, such as "right now",
+// "today", "this afternoon", "tomorrow after 5pm" or "next Tuesday morning", and turns it
+// into a window relative to now. Times of day only narrow a day the question names, so
+// "Are there evening sections?" asks about every day and has no window. It reports false
+// when the question names no day.
+func ParseTimeWindow(question string, now time.Time) (TimeWindow, bool) {
+	q := strings.ToLower(question)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	nowMinutes := now.Hour()*60 + now.Minute()
+
+	window := TimeWindow{Date: today, Start: 0, End: 24 * 60}
+	found := false
+	isToday := true
+
+	// Pick the day first
+	switch {
+	case strings.Contains(q, "right now") || strings.Contains(q, "currently"):
+		return TimeWindow{Date: today, Start: nowMinutes, End: nowMinutes + 1, Label: "right now"}, true
+	case strings.Contains(q, "tomorrow"):
+		window.Date, window.Label, found, isToday = today.AddDate(0, 0, 1), "tomorrow", true, false
+	case strings.Contains(q, "today") || strings.Contains(q, "tonight") || strings.Contains(q, "this morning") ||
+		strings.Contains(q, "this afternoon") || strings.Contains(q, "this evening"):
+		window.Label, found = "today", true
+	default:
+		if match := weekdayPattern.FindStringSubmatch(q); match != nil {
+			target := weekdayIndex(match[2])
+			days := (target - int(today.Weekday()) + 7) % 7
+			if days == 0 && match[1] == "next" {
+				days = 7
+			}
+			window.Date, window.Label, found = today.AddDate(0, 0, days), match[0], true
+			isToday = days == 0
+		}
+	}
+	if !found {
+		return TimeWindow{}, false
+	}
+
+	// Then narrow the time of day
+	morning := strings.Contains(q, "morning")
+	switch {
+	case morning:
+		window.Start, window.End = 0, 12*60
+		window.Label += " morning"
+	case strings.Contains(q, "afternoon"):
+		window.Start, window.End = 12*60, 17*60
+		window.Label += " afternoon"
+	case strings.Contains(q, "evening") || strings.Contains(q, "tonight"):
+		window.Start, window.End = 17*60, 24*60
+		window.Label += " evening"
+	}
+	if match := betweenPattern.FindStringSubmatch(q); match != nil {
+		start, okStart := spokenTimeOfDay(match[1], morning)
+		end, okEnd := spokenTimeOfDay(match[2], morning)
+		if okStart && okEnd && start < end {
+			window.Start, window.End = start, end
+		}
+	} else if match := afterPattern.FindStringSubmatch(q); match != nil {
+		if start, ok := spokenTimeOfDay(match[1], morning); ok {
+			window.Start = start
+		}
+	} else if match := beforePattern.FindStringSubmatch(q); match != nil {
+		if end, ok := spokenTimeOfDay(match[1], morning); ok {
+			window.End = end
+		}
+	} else if match := atPattern.FindStringSubmatch(q); match != nil {
+		if start, ok := spokenTimeOfDay(match[1], morning); ok {
+			window.Start, window.End = start, start+1
+		}
+	}
+
+	// "What's left today" only covers the part of today that hasn't happened yet
+	if isToday && (strings.Contains(q, "left") || strings.Contains(q, "remaining") || strings.Contains(q, "rest of")) {
+		window.Start = max(window.Start, nowMinutes)
+	}
+	return window, true
+}
+
+// spokenTimeOfDay parses a time as said in a question. Bare hours from 1 to 7, as in
+// "after 5" or "between 2 and 4", mean the afternoon or evening when classes meet, unless
+// the question asks about the morning.
+func spokenTimeOfDay(input string, morning bool) (int, bool) {
+	minutes, ok := parseTimeOfDay(input)
+	input = strings.TrimSpace(input)
+	bare := !strings.HasSuffix(input, "am") && !strings.HasSuffix(input, "pm") && !strings.HasPrefix(input, "0")
+	if ok && bare && !morning && minutes >= 60 && minutes < 8*60 {
+		minutes += 12 * 60
+	}
+	return minutes, ok
+}
+
+// weekdayIndex converts a lowercase day name to a time.Weekday value.
+func weekdayIndex(name string) int {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.ToLower(day.String()) == name {
+			return int(day)
+		}
+	}
+	return 0
+}
+
+// parseMeetDate parses the schedule's "8/20/24" dates in the campus time zone.
+func parseMeetDate(value string) (time.Time, bool) {
+	date, err := time.ParseInLocation("1/2/06", strings.TrimSpace(value), campusLocation)
+	return date, err == nil
+}
+
+// inTerm reports whether date falls within the section's meeting start and end dates.
+// Rows without dates are treated as meeting all term.
+func inTerm(course Course, date time.Time) bool {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, campusLocation)
+	if start, ok := parseMeetDate(course.MeetStart); ok && day.Before(start) {
+		return false
+	}
+	if end, ok := parseMeetDate(course.MeetEnd); ok && day.After(end) {
+		return false
+	}
+	return true
+}
+
+// MeetingsInWindow returns the meetings that take place during the window, respecting
+// each row's term dates. Sections with several meeting rows are matched per row.
+func MeetingsInWindow(courses []Course, window TimeWindow) []Meeting {
+	var meetings []Meeting
+	for _, course := range courses {
+		if !inTerm(course, window.Date) {
+			continue
+		}
+		for _, meeting := range courseMeetings(course) {
+			if meeting.Day == window.Day() && meeting.Overlaps(window.Start, window.End) {
+				meetings = append(meetings, meeting)
+			}
+		}
+	}
+	sort.SliceStable(meetings, func(i, j int) bool { return meetings[i].Start < meetings[j].Start })
+	return meetings
+}
+
+// termDates returns the earliest meeting start and latest meeting end in the schedule.
+func termDates(courses []Course) (time.Time, time.Time) {
+	var first, last time.Time
+	for _, course := range courses {
+		if start, ok := parseMeetDate(course.MeetStart); ok && (first.IsZero() || start.Before(first)) {
+			first = start
+		}
+		if end, ok := parseMeetDate(course.MeetEnd); ok && end.After(last) {
+			last = end
+		}
+	}
+	return first, last
+}
+
+// timeContext answers the time-relative part of a question from the schedule. It returns
+// "" when the question does not mention a relative time.
+func (bot *ChatBot) timeContext(ctx context.Context, question string) string {
+	now := bot.clock.Now()
+	window, ok := ParseTimeWindow(question, now)
+	if !ok {
+		return ""
+	}
+
+	subjects, buildings := scheduleFilters(question, bot.metadata.courses)
+	details := answerDetailsFrom(ctx)
+	details.addFilter("meeting %s (%s)", window.Label, window)
+	if len(subjects) > 0 {
+		details.addFilter("subjects %s", strings.Join(sortedKeys(subjects), ", "))
+	}
+	if len(buildings) > 0 {
+		details.addFilter("buildings %s", strings.Join(sortedKeys(buildings), ", "))
+	}
+	var matches []string
+	for _, meeting := range MeetingsInWindow(bot.metadata.courses, window) {
+		course := meeting.Course
+		if len(subjects) > 0 && !subjects[strings.ToUpper(course.Subject)] {
+			continue
+		}
+		if len(buildings) > 0 && !buildings[strings.ToUpper(course.Building)] {
+			continue
+		}
+		matches = append(matches, fmt.Sprintf("- %s %s %s in %s %s (%s, CRN %s)",
+			meeting.String(), course.Title, instructorName(course), course.Building, course.Room, dayNames[meeting.Day], course.CRN))
+	}
+
+	context := fmt.Sprintf("It is now %s %s. The question asks about %s (%s).\n",
+		now.Format("Monday, January 2 2006"), formatClock(now.Hour()*60+now.Minute()), window.Label, window)
+	if first, last := termDates(bot.metadata.courses); !first.IsZero() && (window.Date.Before(first) || window.Date.After(last)) {
+		return context + fmt.Sprintf("That date is outside the %s term, which runs %s to %s, so no classes meet then.",
+			scheduleTerm, first.Format("January 2 2006"), last.Format("January 2 2006"))
+	}
+	if len(matches) == 0 {
+		return context + "No matching sections meet during that time."
+	}
+	return context + "Sections meeting during that time:\n" + strings.Join(matches, "\n")
+}
+
+// scheduleFilters picks out subject codes (case-insensitive) and building codes
+// (upper case, to avoid matching ordinary words) mentioned in the question.
+func scheduleFilters(question string, courses []Course) (map[string]bool, map[string]bool) {
+	knownSubjects := make(map[string]bool)
+	knownBuildings := make(map[string]bool)
+	for _, course := range courses {
+		knownSubjects[strings.ToUpper(course.Subject)] = true
+		knownBuildings[course.Building] = true
+	}
+
+	subjects := make(map[string]bool)
+	buildings := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(question, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '&')
+	}) {
+		if len(word) >= 2 && knownSubjects[strings.ToUpper(word)] {
+			subjects[strings.ToUpper(word)] = true
+		}
+		if word == strings.ToUpper(word) && knownBuildings[word] {
+			buildings[word] = true
+		}
+	}
+	return subjects, buildings
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNow is Tuesday, October 22 2024 at 2:05 PM on campus.
+var testNow = time.Date(2024, time.October, 22, 14, 5, 0, 0, campusLocation)
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		question   string
+		date       string
+		start, end int
+	}{
+		{"What CS classes are happening right now?", "2024-10-22", 14*60 + 5, 14*60 + 6},
+		{"What's left today in LS?", "2024-10-22", 14*60 + 5, 24 * 60},
+		{"Anything this afternoon?", "2024-10-22", 12 * 60, 17 * 60},
+		{"Which classes meet after 5pm today?", "2024-10-22", 17 * 60, 24 * 60},
+		{"What meets next Tuesday morning?", "2024-10-29", 0, 12 * 60},
+		{"What is on tomorrow between 9am and 11am?", "2024-10-23", 9 * 60, 11 * 60},
+		// Hours without am or pm are read as class hours
+		{"Which classes meet after 5 today?", "2024-10-22", 17 * 60, 24 * 60},
+		{"What meets between 2 and 4 tomorrow?", "2024-10-23", 14 * 60, 16 * 60},
+		{"Anything between 10 and 1:30 today?", "2024-10-22", 10 * 60, 13*60 + 30},
+		{"What is over before 9 today?", "2024-10-22", 0, 9 * 60},
+		{"Is anything on after 7 tomorrow morning?", "2024-10-23", 7 * 60, 12 * 60},
+		{"Which classes meet after 17:30 today?", "2024-10-22", 17*60 + 30, 24 * 60},
+	}
+	for _, test := range tests {
+		window, ok := ParseTimeWindow(test.question, testNow)
+		if !ok {
+			t.Errorf("Expected a time window in %q", test.question)
+			continue
+		}
+		if date := window.Date.Format("2006-01-02"); date != test.date || window.Start != test.start || window.End != test.end {
+			t.Errorf("%q: got %s %d-%d, want %s %d-%d", test.question, date, window.Start, window.End, test.date, test.start, test.end)
+		}
+	}
+
+	// Times of day without a day ask about every day, and "now" alone is not "right now"
+	for _, question := range []string{
+		"What can I take after CS 112?",
+		"Are there evening CS sections?",
+		"Which afternoon sections of MATH 109 exist?",
+		"Which classes meet after 5pm?",
+		"Do I need to register now for CS 272?",
+	} {
+		if window, ok := ParseTimeWindow(question, testNow); ok {
+			t.Errorf("Expected no time window in %q, got %s", question, window)
+		}
+	}
+}
+
+func TestMeetingsInWindow(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", MeetDays: "TR", BeginTime: "1330", EndTime: "1510", MeetStart: "8/20/24", MeetEnd: "12/4/24"},
+		// A section with a second meeting row that only runs for part of the term
+		{Subject: "CS", CourseNumber: "601", CRN: "2", MeetDays: "M", BeginTime: "1400", EndTime: "1600", MeetStart: "8/20/24", MeetEnd: "12/4/24"},
+		{Subject: "CS", CourseNumber: "601", CRN: "2", MeetDays: "T", BeginTime: "1400", EndTime: "1600", MeetStart: "8/20/24", MeetEnd: "9/30/24"},
+	}
+
+	window, _ := ParseTimeWindow("right now", testNow)
+	meetings := MeetingsInWindow(courses, window)
+	if len(meetings) != 1 || meetings[0].Course.CourseNumber != "272" {
+		t.Errorf("Expected only CS 272 to be meeting, got %v", meetings)
+	}
+
+	window.Date = time.Date(2024, time.September, 24, 0, 0, 0, 0, campusLocation) // Also a Tuesday
+	if meetings := MeetingsInWindow(courses, window); len(meetings) != 2 {
+		t.Errorf("Expected CS 272 and the September meeting of CS 601, got %v", meetings)
+	}
+}
+
+func TestTimeContext(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", MeetDays: "TR", BeginTime: "1330", EndTime: "1510",
+			MeetStart: "8/20/24", MeetEnd: "12/4/24", Building: "LS", Room: "G12"},
+		{Subject: "MATH", CourseNumber: "109", CRN: "2", MeetDays: "TR", BeginTime: "1330", EndTime: "1510", MeetStart: "8/20/24", MeetEnd: "12/4/24"},
+	}
+	chatbot := NewChatBot(nil, &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetClock(fixedClock(testNow))
+
+	note := chatbot.timeContext(context.Background(), "What CS classes are happening right now?")
+	if !strings.Contains(note, "CS 272") || strings.Contains(note, "MATH 109") {
+		t.Errorf("Expected only CS 272 in the time context, got:\n%s", note)
+	}
+
+	chatbot.SetClock(fixedClock(testNow.AddDate(1, 0, 0)))
+	if note := chatbot.timeContext(context.Background(), "What CS classes are happening right now?"); !strings.Contains(note, "outside the "+scheduleTerm+" term") {
+		t.Errorf("Expected an out-of-term note, got:\n%s", note)
+	}
+}
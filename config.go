@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	chromaopenai "github.com/amikos-tech/chroma-go/openai"
+	openai "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath is read when it exists and no other config file is named.
+const defaultConfigPath = "catalog.yaml"
+
+// Config holds every setting of the catalog assistant. Values are layered: defaults,
+// then the YAML config file, then environment variables, then command-line flags.
+type Config struct {
+	OpenAI    OpenAIConfig      `yaml:"openai"`
+	Schedule  ScheduleConfig    `yaml:"schedule"`
+	Store     string            `yaml:"store"` // chroma or memory
+	Chroma    ChromaConfig      `yaml:"chroma"`
+	Embedding EmbeddingConfig   `yaml:"embedding"`
+	Retrieval RetrievalConfig   `yaml:"retrieval"`
+	Search    SearchConfig      `yaml:"search"`
+	Timeouts  TimeoutConfig     `yaml:"timeouts"`
+	Sessions  SessionConfig     `yaml:"sessions"`
+	Answers   AnswerCacheConfig `yaml:"answer_cache"`
+	Usage     UsageConfig       `yaml:"usage"`
+	Log       LogConfig         `yaml:"log"`
+	Prompts   PromptConfig      `yaml:"prompts"`
+	REPL      REPLConfig        `yaml:"repl"`
+}
+
+// OpenAIConfig configures the chat model and API access.
+type OpenAIConfig struct {
+	APIKey string `yaml:"api_key"`
+	Model  string `yaml:"model"`
+}
+
+// ScheduleConfig names the data files.
+type ScheduleConfig struct {
+	CSVPath     string `yaml:"csv_path"`
+	CatalogPath string `yaml:"catalog_path"` // Optional catalog descriptions and prerequisites
+}
+
+// ChromaConfig configures the vector store.
+type ChromaConfig struct {
+	URL                   string `yaml:"url"`
+	CoursesCollection     string `yaml:"courses_collection"`
+	InstructorsCollection string `yaml:"instructors_collection"`
+	DocumentsCollection   string `yaml:"documents_collection"`
+	AddRetries            int    `yaml:"add_retries"`
+}
+
+// EmbeddingConfig selects the embedding model and where computed embeddings are cached.
+type EmbeddingConfig struct {
+	Model     string `yaml:"model"`
+	CachePath string `yaml:"cache_path"` // JSON-lines cache file; empty disables caching
+}
+
+// RetrievalConfig controls how many documents are retrieved and which count as relevant.
+type RetrievalConfig struct {
+	QuestionResults int     `yaml:"question_results"` // Documents retrieved per question
+	CourseResults   int     `yaml:"course_results"`   // Documents retrieved by QueryCourses
+	MaxDistance     float32 `yaml:"max_distance"`
+	KeepSummary     bool    `yaml:"keep_summary"` // Keep a summary of the documents shown for each question in the conversation
+}
+
+// SearchConfig selects the web search provider: an HTTP endpoint or a local site index.
+type SearchConfig struct {
+	Endpoint     string `yaml:"endpoint"`
+	APIKey       string `yaml:"api_key"`
+	SiteIndexDir string `yaml:"site_index_dir"`
+	SiteBaseURL  string `yaml:"site_base_url"`
+}
+
+// TimeoutConfig limits how long each stage of answering may take. Zero means no limit.
+type TimeoutConfig struct {
+	Question   time.Duration `yaml:"question"`   // Whole answer, including tool calls
+	Retrieval  time.Duration `yaml:"retrieval"`  // Each vector store query
+	Completion time.Duration `yaml:"completion"` // Each chat completion request
+	Search     time.Duration `yaml:"search"`     // Each web search
+	Store      time.Duration `yaml:"store"`      // Connecting to and loading the vector store
+}
+
+// SessionConfig controls the conversations kept by serve mode.
+type SessionConfig struct {
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // Forget conversations idle this long; zero keeps them
+}
+
+// AnswerCacheConfig controls reuse of answers to repeated questions.
+type AnswerCacheConfig struct {
+	TTL            time.Duration `yaml:"ttl"`             // How long an answer is reused; zero disables the cache
+	Similarity     float64       `yaml:"similarity"`      // Minimum embedding similarity for a near-duplicate question
+	WordSimilarity float64       `yaml:"word_similarity"` // Minimum word overlap for a near duplicate, without embeddings
+	MaxEntries     int           `yaml:"max_entries"`     // Oldest answers are dropped beyond this
+}
+
+// UsageConfig sets usage budgets and the model prices used to estimate cost. When a
+// budget is exceeded, questions are answered with the downgrade model, or refused if
+// there is none.
+type UsageConfig struct {
+	SessionTokens  int                   `yaml:"session_tokens"`  // Tokens one conversation may use; zero is unlimited
+	DailyCost      float64               `yaml:"daily_cost"`      // US dollars all conversations may spend per day; zero is unlimited
+	DowngradeModel string                `yaml:"downgrade_model"` // Cheaper chat model used over budget; empty refuses instead
+	Prices         map[string]ModelPrice `yaml:"prices"`          // Keyed by model name
+}
+
+// ModelPrice is what a model charges in US dollars per million tokens.
+type ModelPrice struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// LogConfig controls structured logging and request tracing.
+type LogConfig struct {
+	Level     string `yaml:"level"`      // debug, info, warn or error; empty is info, or warn in chat
+	Format    string `yaml:"format"`     // text or json
+	File      string `yaml:"file"`       // Empty logs to standard error
+	TraceFile string `yaml:"trace_file"` // Spans are appended here as OTLP JSON; empty disables tracing
+}
+
+// PromptConfig selects the prompt templates.
+type PromptConfig struct {
+	Dir string `yaml:"dir"` // Templates here replace the built-in ones of the same name; empty uses the built-ins
+}
+
+// REPLConfig controls the interactive chat.
+type REPLConfig struct {
+	HistoryFile string `yaml:"history_file"` // Lines entered are kept here across sessions; empty keeps them for one session
+	HistorySize int    `yaml:"history_size"` // Lines kept; zero keeps all
+}
+
+// withTimeout limits ctx to d. A zero d only adds cancellation.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// DefaultConfig returns the built-in settings.
+func DefaultConfig() *Config {
+	return &Config{
+		OpenAI: OpenAIConfig{
+			Model: openai.GPT4oMini,
+		},
+		Schedule: ScheduleConfig{
+			CSVPath: "Fall 2024 Class Schedule 08082024.csv",
+		},
+		Store: storeChroma,
+		Chroma: ChromaConfig{
+			URL:                   "http://localhost:8000",
+			CoursesCollection:     "courses-collection",
+			InstructorsCollection: "instructors-collection",
+			DocumentsCollection:   "documents-collection",
+			AddRetries:            3,
+		},
+		Embedding: EmbeddingConfig{
+			Model:     string(chromaopenai.TextEmbeddingAda002),
+			CachePath: filepath.Join(".catalog-cache", "embeddings.jsonl"),
+		},
+		Retrieval: RetrievalConfig{
+			QuestionResults: 10,
+			CourseResults:   5,
+			MaxDistance:     defaultMaxDistance,
+		},
+		Timeouts: TimeoutConfig{
+			Question:   2 * time.Minute,
+			Retrieval:  10 * time.Second,
+			Completion: time.Minute,
+			Search:     10 * time.Second,
+			Store:      30 * time.Minute,
+		},
+		Sessions: SessionConfig{
+			IdleTimeout: 30 * time.Minute,
+		},
+		Answers: AnswerCacheConfig{
+			TTL:        time.Hour,
+			Similarity: 0.97, // Embeddings of different questions about the same course score above 0.9
+			// Only questions of six or more words may differ in one, so "not" or
+			// another course number is enough to miss
+			WordSimilarity: 0.85,
+			MaxEntries:     1000,
+		},
+		Log: LogConfig{
+			Format: logFormatText,
+		},
+		REPL: REPLConfig{
+			HistoryFile: filepath.Join(".catalog-cache", "history"),
+			HistorySize: 1000,
+		},
+		Usage: UsageConfig{
+			Prices: map[string]ModelPrice{
+				openai.GPT4oMini:                         {Input: 0.15, Output: 0.60},
+				openai.GPT4o:                             {Input: 2.50, Output: 10.00},
+				openai.GPT4Turbo:                         {Input: 10.00, Output: 30.00},
+				openai.GPT3Dot5Turbo:                     {Input: 0.50, Output: 1.50},
+				string(chromaopenai.TextEmbeddingAda002): {Input: 0.10},
+				string(chromaopenai.TextEmbedding3Small): {Input: 0.02},
+				string(chromaopenai.TextEmbedding3Large): {Input: 0.13},
+			},
+		},
+	}
+}
+
+// LoadConfig builds the configuration from defaults, the config file at path and the
+// environment. An empty path means $CATALOG_CONFIG, or catalog.yaml if it exists.
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv("CATALOG_CONFIG")
+		explicit = path != ""
+	}
+	if path == "" {
+		path = defaultConfigPath
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("Error parsing config %s: %w", path, err)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("Error reading config: %w", err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings from environment variables.
+func (cfg *Config) applyEnv() error {
+	stringVars := map[string]*string{
+		"OPENAI_PROJECT_KEY":      &cfg.OpenAI.APIKey,
+		"CATALOG_MODEL":           &cfg.OpenAI.Model,
+		"CATALOG_CSV":             &cfg.Schedule.CSVPath,
+		"CATALOG_FILE":            &cfg.Schedule.CatalogPath,
+		"CATALOG_STORE":           &cfg.Store,
+		"CATALOG_CHROMA_URL":      &cfg.Chroma.URL,
+		"CATALOG_EMBED_MODEL":     &cfg.Embedding.Model,
+		"CATALOG_EMBED_CACHE":     &cfg.Embedding.CachePath,
+		"CATALOG_DOWNGRADE_MODEL": &cfg.Usage.DowngradeModel,
+		"CATALOG_LOG_LEVEL":       &cfg.Log.Level,
+		"CATALOG_LOG_FORMAT":      &cfg.Log.Format,
+		"CATALOG_LOG_FILE":        &cfg.Log.File,
+		"CATALOG_TRACE_FILE":      &cfg.Log.TraceFile,
+		"CATALOG_PROMPTS_DIR":     &cfg.Prompts.Dir,
+		"CATALOG_HISTORY_FILE":    &cfg.REPL.HistoryFile,
+		"SEARCH_ENDPOINT":         &cfg.Search.Endpoint,
+		"SEARCH_API_KEY":          &cfg.Search.APIKey,
+		"SITE_INDEX_DIR":          &cfg.Search.SiteIndexDir,
+		"SITE_BASE_URL":           &cfg.Search.SiteBaseURL,
+	}
+	for name, field := range stringVars {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			*field = value
+		}
+	}
+
+	ints := map[string]*int{
+		"CATALOG_QUESTION_RESULTS": &cfg.Retrieval.QuestionResults,
+		"CATALOG_COURSE_RESULTS":   &cfg.Retrieval.CourseResults,
+		"CATALOG_ADD_RETRIES":      &cfg.Chroma.AddRetries,
+		"CATALOG_SESSION_TOKENS":   &cfg.Usage.SessionTokens,
+		"CATALOG_HISTORY_SIZE":     &cfg.REPL.HistorySize,
+	}
+	for name, field := range ints {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a number: %w", name, err)
+			}
+			*field = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"CATALOG_QUESTION_TIMEOUT":   &cfg.Timeouts.Question,
+		"CATALOG_RETRIEVAL_TIMEOUT":  &cfg.Timeouts.Retrieval,
+		"CATALOG_COMPLETION_TIMEOUT": &cfg.Timeouts.Completion,
+		"CATALOG_SEARCH_TIMEOUT":     &cfg.Timeouts.Search,
+		"CATALOG_STORE_TIMEOUT":      &cfg.Timeouts.Store,
+		"CATALOG_SESSION_IDLE":       &cfg.Sessions.IdleTimeout,
+		"CATALOG_ANSWER_TTL":         &cfg.Answers.TTL,
+	}
+	for name, field := range durations {
+		if value, ok := os.LookupEnv(name); ok && value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration such as 30s: %w", name, err)
+			}
+			*field = d
+		}
+	}
+
+	if value, ok := os.LookupEnv("CATALOG_MAX_DISTANCE"); ok && value != "" {
+		distance, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return fmt.Errorf("CATALOG_MAX_DISTANCE must be a number: %w", err)
+		}
+		cfg.Retrieval.MaxDistance = float32(distance)
+	}
+	if value, ok := os.LookupEnv("CATALOG_KEEP_SUMMARY"); ok && value != "" {
+		keep, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("CATALOG_KEEP_SUMMARY must be true or false: %w", err)
+		}
+		cfg.Retrieval.KeepSummary = keep
+	}
+	if value, ok := os.LookupEnv("CATALOG_DAILY_COST"); ok && value != "" {
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("CATALOG_DAILY_COST must be a number: %w", err)
+		}
+		cfg.Usage.DailyCost = cost
+	}
+	return nil
+}
+
+// Validate reports the first invalid setting.
+func (cfg *Config) Validate() error {
+	if cfg.Schedule.CSVPath == "" {
+		return errors.New("schedule.csv_path is required")
+	}
+	if _, err := os.Stat(cfg.Schedule.CSVPath); err != nil {
+		return fmt.Errorf("schedule.csv_path: %w", err)
+	}
+	if cfg.Schedule.CatalogPath != "" {
+		if _, err := os.Stat(cfg.Schedule.CatalogPath); err != nil {
+			return fmt.Errorf("schedule.catalog_path: %w", err)
+		}
+	}
+	if cfg.Prompts.Dir != "" {
+		if info, err := os.Stat(cfg.Prompts.Dir); err != nil {
+			return fmt.Errorf("prompts.dir: %w", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("prompts.dir %s is not a directory", cfg.Prompts.Dir)
+		}
+	}
+	if cfg.Store != storeChroma && cfg.Store != storeMemory {
+		return fmt.Errorf("store must be %s or %s, got %q", storeChroma, storeMemory, cfg.Store)
+	}
+	if cfg.Store == storeChroma {
+		if u, err := url.Parse(cfg.Chroma.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("chroma.url must be an absolute URL, got %q", cfg.Chroma.URL)
+		}
+		if cfg.Chroma.CoursesCollection == "" || cfg.Chroma.InstructorsCollection == "" || cfg.Chroma.DocumentsCollection == "" {
+			return errors.New("chroma collection names must not be empty")
+		}
+	}
+	switch chromaopenai.EmbeddingModel(cfg.Embedding.Model) {
+	case chromaopenai.TextEmbeddingAda002, chromaopenai.TextEmbedding3Small, chromaopenai.TextEmbedding3Large:
+	default:
+		return fmt.Errorf("embedding.model %q is not an OpenAI embedding model", cfg.Embedding.Model)
+	}
+	if cfg.Chroma.AddRetries < 1 {
+		return fmt.Errorf("chroma.add_retries must be at least 1, got %d", cfg.Chroma.AddRetries)
+	}
+	if cfg.OpenAI.Model == "" {
+		return errors.New("openai.model is required")
+	}
+	if cfg.Retrieval.QuestionResults < 1 || cfg.Retrieval.CourseResults < 1 {
+		return errors.New("retrieval result counts must be at least 1")
+	}
+	if cfg.Retrieval.MaxDistance <= 0 {
+		return fmt.Errorf("retrieval.max_distance must be positive, got %v", cfg.Retrieval.MaxDistance)
+	}
+	timeouts := cfg.Timeouts
+	if timeouts.Question < 0 || timeouts.Retrieval < 0 || timeouts.Completion < 0 || timeouts.Search < 0 || timeouts.Store < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if cfg.Sessions.IdleTimeout < 0 {
+		return errors.New("sessions.idle_timeout must not be negative")
+	}
+	if cfg.Answers.TTL < 0 || cfg.Answers.MaxEntries < 0 {
+		return errors.New("answer_cache.ttl and answer_cache.max_entries must not be negative")
+	}
+	if cfg.Answers.Similarity <= 0 || cfg.Answers.Similarity > 1 {
+		return fmt.Errorf("answer_cache.similarity must be in (0, 1], got %v", cfg.Answers.Similarity)
+	}
+	if cfg.Answers.WordSimilarity <= 0 || cfg.Answers.WordSimilarity > 1 {
+		return fmt.Errorf("answer_cache.word_similarity must be in (0, 1], got %v", cfg.Answers.WordSimilarity)
+	}
+	if cfg.Usage.SessionTokens < 0 || cfg.Usage.DailyCost < 0 {
+		return errors.New("usage.session_tokens and usage.daily_cost must not be negative")
+	}
+	for model, price := range cfg.Usage.Prices {
+		if price.Input < 0 || price.Output < 0 {
+			return fmt.Errorf("usage.prices.%s must not be negative", model)
+		}
+	}
+	if cfg.REPL.HistorySize < 0 {
+		return fmt.Errorf("repl.history_size must not be negative, got %d", cfg.REPL.HistorySize)
+	}
+	if cfg.Log.Level != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+			return fmt.Errorf("log.level must be debug, info, warn or error, got %q", cfg.Log.Level)
+		}
+	}
+	if cfg.Log.Format != logFormatText && cfg.Log.Format != logFormatJSON {
+		return fmt.Errorf("log.format must be %s or %s, got %q", logFormatText, logFormatJSON, cfg.Log.Format)
+	}
+	if cfg.Search.Endpoint != "" {
+		if u, err := url.Parse(cfg.Search.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("search.endpoint must be an absolute URL, got %q", cfg.Search.Endpoint)
+		}
+	}
+	return nil
+}
+
+// redacted returns a copy of the configuration with secrets hidden.
+func (cfg *Config) redacted() Config {
+	safe := *cfg
+	if safe.OpenAI.APIKey != "" {
+		safe.OpenAI.APIKey = redactSecret(safe.OpenAI.APIKey)
+	}
+	if safe.Search.APIKey != "" {
+		safe.Search.APIKey = redactSecret(safe.Search.APIKey)
+	}
+	return safe
+}
+
+// redactSecret keeps only the last four characters of a secret.
+func redactSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+// Print writes the effective configuration as YAML with secrets redacted.
+func (cfg *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigLayering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.yaml")
+	yamlConfig := "store: memory\nopenai:\n  model: gpt-4o\nretrieval:\n  question_results: 7\n  max_distance: 0.4\n"
+	if err := os.WriteFile(path, []byte(yamlConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CATALOG_MODEL", "gpt-4o-mini")
+	t.Setenv("CATALOG_COURSE_RESULTS", "3")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Store != storeMemory || cfg.Retrieval.QuestionResults != 7 || cfg.Retrieval.MaxDistance != 0.4 {
+		t.Errorf("Expected file settings to apply, got %+v", cfg)
+	}
+	if cfg.OpenAI.Model != "gpt-4o-mini" || cfg.Retrieval.CourseResults != 3 {
+		t.Errorf("Expected environment to override the file, got %+v", cfg)
+	}
+	if cfg.Chroma.CoursesCollection != "courses-collection" {
+		t.Errorf("Expected defaults for unset values, got %q", cfg.Chroma.CoursesCollection)
+	}
+
+	// Flags override both.
+	opts := options{configPath: path, model: "gpt-4-turbo", format: formatText}
+	cfg, err = opts.config()
+	if err != nil {
+		t.Fatalf("config failed: %v", err)
+	}
+	if cfg.OpenAI.Model != "gpt-4-turbo" {
+		t.Errorf("Expected --model to override, got %q", cfg.OpenAI.Model)
+	}
+
+	t.Setenv("CATALOG_ADD_RETRIES", "many")
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("Expected a non-numeric CATALOG_ADD_RETRIES to be rejected")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"missing csv", func(cfg *Config) { cfg.Schedule.CSVPath = "missing.csv" }, "schedule.csv_path"},
+		{"unknown store", func(cfg *Config) { cfg.Store = "redis" }, "store must be"},
+		{"bad chroma url", func(cfg *Config) { cfg.Chroma.URL = "localhost" }, "chroma.url"},
+		{"no retries", func(cfg *Config) { cfg.Chroma.AddRetries = 0 }, "add_retries"},
+		{"negative distance", func(cfg *Config) { cfg.Retrieval.MaxDistance = -1 }, "max_distance"},
+	}
+	for _, test := range tests {
+		cfg := DefaultConfig()
+		test.modify(cfg)
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected error mentioning %q, got %v", test.name, test.want, err)
+		}
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid, got %v", err)
+	}
+}
+
+func TestConfigPrintRedactsSecrets(t *testing.T) {
+	t.Setenv("OPENAI_PROJECT_KEY", "sk-proj-abcdefghijkl1234")
+	var out bytes.Buffer
+	if err := run([]string{"config", "print", "--store", "memory"}, &out); err != nil {
+		t.Fatalf("config print failed: %v", err)
+	}
+	if strings.Contains(out.String(), "abcdefghijkl") {
+		t.Errorf("Expected the API key to be redacted:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "api_key: '****1234'") || !strings.Contains(out.String(), "store: memory") {
+		t.Errorf("Unexpected config output:\n%s", out.String())
+	}
+}
+
+func TestConfigPrintInvalid(t *testing.T) {
+	var out bytes.Buffer
+	err := run([]string{"config", "print", "--csv", "missing.csv"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "schedule.csv_path") {
+		t.Errorf("Expected the missing CSV to be reported, got %v", err)
+	}
+	if !strings.Contains(out.String(), "csv_path: missing.csv") {
+		t.Errorf("Expected the configuration to be printed anyway:\n%s", out.String())
+	}
+}
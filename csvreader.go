@@ -1,9 +1,11 @@
 package main
 
 import (
+    "bufio"
+    "bytes"
     "io"
     "github.com/gocarina/gocsv"
-    "log"
+    "log/slog"
     "encoding/csv"
 )
 
@@ -33,22 +35,36 @@ type Course struct {
     College                   string `csv:"College"`
 }
 
+// ReadCSV parses course records from file. The input must start with the header row;
+// the delimiter (comma or tab) is detected from that header.
 func ReadCSV(file io.Reader) ([]Course, error) {
-    // Set up gocsv to use a custom CSV reader with LazyQuotes enabled
-    gocsv.SetCSVReader(func(in io.Reader) gocsv.CSVReader {
-        reader := csv.NewReader(file)
-        reader.Comma = '\t'          // Set to tab-delimited
-        reader.LazyQuotes = true     // Enable lazy quotes to handle unescaped quotes
-        reader.FieldsPerRecord = -1  // Allow variable field counts if needed
-        return reader
-    })
+    in := bufio.NewReader(file)
+
+    // Set up a CSV reader with LazyQuotes enabled
+    reader := csv.NewReader(in)
+    reader.Comma = detectDelimiter(in)
+    reader.LazyQuotes = true     // Enable lazy quotes to handle unescaped quotes
+    reader.FieldsPerRecord = -1  // Allow variable field counts if needed
 
     var courses []Course
-    if err := gocsv.Unmarshal(file, &courses); err != nil {
-        log.Printf("Failed to unmarshal CSV file: %v", err)
+    if err := gocsv.UnmarshalCSV(reader, &courses); err != nil {
+        slog.Error("Failed to unmarshal CSV file", "err", err)
         return nil, err
     }
     
-    log.Printf("Successfully read %d records from CSV.", len(courses))
+    slog.Info("Read records from CSV", "records", len(courses))
     return courses, nil
 }
+
+// detectDelimiter peeks at the header row and returns tab for tab-delimited exports
+// and comma otherwise.
+func detectDelimiter(in *bufio.Reader) rune {
+    peek, _ := in.Peek(in.Size())
+    if i := bytes.IndexByte(peek, '\n'); i >= 0 {
+        peek = peek[:i]
+    }
+    if bytes.Count(peek, []byte{'\t'}) > bytes.Count(peek, []byte{','}) {
+        return '\t'
+    }
+    return ','
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadCSVDelimiters(t *testing.T) {
+	for name, data := range map[string]string{
+		"comma": "SUBJ,CRSE NUM,SEC,CRN,Title Short Desc\nCS,110,01,40630,\"Intro to CS, Part 1\"\nMATH,109,02,41002,Calculus I\n",
+		"tab":   "SUBJ\tCRSE NUM\tSEC\tCRN\tTitle Short Desc\nCS\t110\t01\t40630\tIntro to CS, Part 1\nMATH\t109\t02\t41002\tCalculus I\n",
+	} {
+		courses, err := ReadCSV(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(courses) != 2 || courses[0].CRN != "40630" || courses[0].Title != "Intro to CS, Part 1" || courses[1].Subject != "MATH" {
+			t.Errorf("%s: unexpected courses %+v", name, courses)
+		}
+	}
+}
+
+func TestMetadataExtractorKeepsHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.csv")
+	data := "SUBJ,CRSE NUM,SEC,CRN,Primary Instructor First Name,Primary Instructor Last Name\r\nCS,110,01,40630,Julia,Nolfo\r\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := NewMetadataExtractor(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header is kept and still parsed, so the first course is not lost
+	if metadata.header != "SUBJ,CRSE NUM,SEC,CRN,Primary Instructor First Name,Primary Instructor Last Name" {
+		t.Errorf("Unexpected header %q", metadata.header)
+	}
+	if len(metadata.courses) != 1 || metadata.courses[0].CRN != "40630" {
+		t.Errorf("Expected the one course, got %+v", metadata.courses)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// AnswerDetails traces how a question was answered, stage by stage, for callers that
+// inspect more than the answer text: the eval command, and debug output in the REPL,
+// "ask --debug" and the API's debug parameter. Its recording methods do nothing on a
+// nil *AnswerDetails, so stages record unconditionally.
+type AnswerDetails struct {
+	Question         string                         `json:"question"` // As retrieved for, after instructor aliases were replaced
+	Substitutions    []AliasSubstitution            `json:"substitutions"`
+	Route            string                         `json:"route"`            // How the answer was produced, one of the route constants
+	Intent           string                         `json:"intent,omitempty"` // What the model made of the question, for typed answers
+	Collection       string                         `json:"collection,omitempty"`
+	Filters          []string                       `json:"filters"`   // Filters applied to what was retrieved, described
+	Retrieved        []TracedDocument               `json:"retrieved"` // Everything retrieval returned, closest first
+	Prompt           []openai.ChatCompletionMessage `json:"prompt"`    // Messages of the last request to the model; empty if it was not asked
+	Model            string                         `json:"model,omitempty"`
+	PromptTokens     int                            `json:"prompt_tokens"` // Over every request for the answer, including tool rounds
+	CompletionTokens int                            `json:"completion_tokens"`
+}
+
+// AliasSubstitution records an instructor alias replaced in the question.
+type AliasSubstitution struct {
+	Alias      string `json:"alias"`
+	Instructor string `json:"instructor"`
+}
+
+// TracedDocument is a retrieved document as shown in a trace.
+type TracedDocument struct {
+	ID       string  `json:"id"`
+	Distance float32 `json:"distance"`
+	Relevant bool    `json:"relevant"` // Close enough to be given to the model
+	Text     string  `json:"text"`
+}
+
+// How an answer was produced.
+const (
+	routeModel         = "model"           // Asked the model
+	routeCache         = "cache"           // Reused an earlier answer to the same question
+	routeClarification = "clarification"   // Asked which course or instructor was meant, or said it is not offered
+	routeNotInSchedule = "not_in_schedule" // Nothing relevant was found to answer from
+	routeWebSearch     = "web_search"      // Looked up university web pages
+)
+
+// localCollection stands in for the collection name when in-process matching retrieved
+// the documents.
+const localCollection = "local"
+
+// answerDetailsKey carries an *AnswerDetails in a context.
+type answerDetailsKey struct{}
+
+// WithAnswerDetails returns a context under which answering a question fills in the
+// returned details.
+func WithAnswerDetails(ctx context.Context) (context.Context, *AnswerDetails) {
+	details := &AnswerDetails{}
+	return context.WithValue(ctx, answerDetailsKey{}, details), details
+}
+
+// answerDetailsFrom returns the details to fill in for ctx, or nil if nobody asked.
+func answerDetailsFrom(ctx context.Context) *AnswerDetails {
+	details, _ := ctx.Value(answerDetailsKey{}).(*AnswerDetails)
+	return details
+}
+
+func (d *AnswerDetails) substituted(alias, instructor string) {
+	if d != nil {
+		d.Substitutions = append(d.Substitutions, AliasSubstitution{Alias: alias, Instructor: instructor})
+	}
+}
+
+func (d *AnswerDetails) setQuestion(question string) {
+	if d != nil {
+		d.Question = question
+	}
+}
+
+func (d *AnswerDetails) setRoute(route string) {
+	if d != nil {
+		d.Route = route
+	}
+}
+
+func (d *AnswerDetails) setIntent(intent string) {
+	if d != nil {
+		d.Intent = intent
+	}
+}
+
+func (d *AnswerDetails) addFilter(format string, args ...any) {
+	if d != nil {
+		d.Filters = append(d.Filters, fmt.Sprintf(format, args...))
+	}
+}
+
+// retrieved records what retrieval from collection returned and which of it is relevant.
+func (d *AnswerDetails) retrieved(collection string, all, relevant []RetrievedDocument) {
+	if d == nil {
+		return
+	}
+	d.Collection = collection
+	kept := make(map[string]bool, len(relevant))
+	for _, doc := range relevant {
+		kept[doc.ID] = true
+	}
+	d.Retrieved = make([]TracedDocument, len(all))
+	for i, doc := range all {
+		d.Retrieved[i] = TracedDocument{ID: doc.ID, Distance: doc.Distance, Relevant: kept[doc.ID], Text: doc.Document}
+	}
+}
+
+// requested records a request to the model and the usage it reported.
+func (d *AnswerDetails) requested(req openai.ChatCompletionRequest, usage openai.Usage) {
+	if d == nil {
+		return
+	}
+	d.Route = routeModel
+	d.Prompt = req.Messages
+	d.Model = req.Model
+	d.PromptTokens += usage.PromptTokens
+	d.CompletionTokens += usage.CompletionTokens
+}
+
+// writeDebug shows the trace of an answer as text: the stages, the documents retrieved,
+// the prompt sent and the tokens it took.
+func writeDebug(w io.Writer, details *AnswerDetails) error {
+	var b strings.Builder
+	b.WriteString("\n--- Trace\n")
+	fmt.Fprintf(&b, "Question:    %s\n", details.Question)
+	for _, substitution := range details.Substitutions {
+		fmt.Fprintf(&b, "Alias:       %s -> %s\n", substitution.Alias, substitution.Instructor)
+	}
+	fmt.Fprintf(&b, "Route:       %s\n", details.Route)
+	if details.Intent != "" {
+		fmt.Fprintf(&b, "Intent:      %s\n", details.Intent)
+	}
+	if details.Collection != "" {
+		fmt.Fprintf(&b, "Collection:  %s\n", details.Collection)
+	}
+	for _, filter := range details.Filters {
+		fmt.Fprintf(&b, "Filter:      %s\n", filter)
+	}
+
+	b.WriteString("--- Documents\n")
+	if len(details.Retrieved) == 0 {
+		b.WriteString("(none)\n")
+	}
+	for i, doc := range details.Retrieved {
+		relevance := ""
+		if !doc.Relevant {
+			relevance = " not relevant"
+		}
+		fmt.Fprintf(&b, "%2d. %s (distance %.3f%s) %s\n", i+1, doc.ID, doc.Distance, relevance, truncate(firstLine(doc.Text), 80))
+	}
+
+	b.WriteString("--- Prompt\n")
+	if len(details.Prompt) == 0 {
+		b.WriteString("(the model was not asked)\n")
+	}
+	for _, message := range details.Prompt {
+		content := message.Content
+		for _, call := range message.ToolCalls {
+			content += fmt.Sprintf("\n%s(%s)", call.Function.Name, call.Function.Arguments)
+		}
+		fmt.Fprintf(&b, "[%s] %s\n", message.Role, strings.TrimSpace(content))
+	}
+	if details.Model != "" {
+		fmt.Fprintf(&b, "--- Tokens\n%s: %d prompt, %d completion\n", details.Model, details.PromptTokens, details.CompletionTokens)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// firstLine returns s up to its first line break.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
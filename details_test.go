@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestAnswerDetails(t *testing.T) {
+	llm := newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Philip Peterson teaches CS 110."},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 120, CompletionTokens: 8},
+		})
+	})
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "41001", Title: "Introduction to Computer Science", MeetDays: "TR",
+			BeginTime: "1330", EndTime: "1510", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+		{Subject: "MATH", CourseNumber: "109", Section: "02", CRN: "41002", Title: "Calculus I", InstructorFirstName: "Ada", InstructorLastName: "Lovelace"},
+	}
+	chatbot := NewChatBot(llm, &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetClock(fixedClock(testNow))
+
+	ctx, details := WithAnswerDetails(context.Background())
+	if _, err := chatbot.Answer(ctx, NewSession("alice"), "What does Phil Peterson teach?"); err != nil {
+		t.Fatal(err)
+	}
+	if details.Question != "What does Philip Peterson teach?" || len(details.Substitutions) != 1 ||
+		details.Substitutions[0] != (AliasSubstitution{Alias: "Phil Peterson", Instructor: "Philip Peterson"}) {
+		t.Errorf("Expected the alias substitution to be traced, got %q %+v", details.Question, details.Substitutions)
+	}
+	if details.Route != routeModel || details.Collection != localCollection || len(details.Filters) != 1 {
+		t.Errorf("Unexpected route %q, collection %q or filters %v", details.Route, details.Collection, details.Filters)
+	}
+	if len(details.Retrieved) == 0 || details.Retrieved[0].ID != "41001" || !details.Retrieved[0].Relevant {
+		t.Errorf("Expected the retrieved documents with their distances, got %+v", details.Retrieved)
+	}
+	// The conversation keeps the question as asked; only retrieval uses the canonical name
+	if len(details.Prompt) != 3 || details.Prompt[1].Content != "What does Phil Peterson teach?" || details.Prompt[2].Role != openai.ChatMessageRoleSystem {
+		t.Errorf("Expected the system prompt, the question and this turn's context, got %+v", details.Prompt)
+	}
+	if details.Model != openai.GPT4oMini || details.PromptTokens != 120 || details.CompletionTokens != 8 {
+		t.Errorf("Unexpected model %q or tokens %d/%d", details.Model, details.PromptTokens, details.CompletionTokens)
+	}
+
+	var out strings.Builder
+	writeDebug(&out, details)
+	for _, want := range []string{
+		"Alias:       Phil Peterson -> Philip Peterson\n",
+		"Route:       model\n",
+		" 1. 41001 (distance ",
+		"[user] What does Phil Peterson teach?\n[system] Based on the available information",
+		"--- Tokens\ngpt-4o-mini: 120 prompt, 8 completion\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the trace to contain %q, got\n%s", want, out.String())
+		}
+	}
+
+	// Time questions trace the window and the subjects they are narrowed to
+	ctx, details = WithAnswerDetails(context.Background())
+	if _, err := chatbot.Answer(ctx, NewSession("bob"), "What CS classes are happening right now?"); err != nil {
+		t.Fatal(err)
+	}
+	if filters := strings.Join(details.Filters, "; "); !strings.Contains(filters, "meeting right now (Tuesday, Oct 22 2024") || !strings.Contains(filters, "subjects CS") {
+		t.Errorf("Expected the time window and subject filters, got %q", filters)
+	}
+
+	// Answers given without the model say so
+	ctx, details = WithAnswerDetails(context.Background())
+	if _, err := chatbot.Answer(ctx, NewSession("carol"), "Who teaches ASTRO 999?"); err != nil {
+		t.Fatal(err)
+	}
+	if details.Route != routeNotInSchedule || len(details.Prompt) != 0 {
+		t.Errorf("Expected no prompt for a course not in the schedule, got %q with %d messages", details.Route, len(details.Prompt))
+	}
+}
+
+func TestAskDebugParameter(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	var calls atomic.Int32
+	chatbot := NewChatBot(structuredLLM(t, &calls), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	handler := newServer(NewSessionManager(chatbot, time.Hour))
+
+	var response askResponse
+	recorder := postQuestion(handler, `{"question": "Who teaches CS 110?", "debug": true}`, "")
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected JSON, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if response.Debug == nil || response.Debug.Route != routeModel || response.Debug.Intent != intentInstructor || len(response.Debug.Prompt) == 0 {
+		t.Errorf("Expected a trace with the answer, got %+v", response.Debug)
+	}
+
+	recorder = postQuestion(handler, `{"question": "Who teaches CS 110?"}`, "")
+	if strings.Contains(recorder.Body.String(), `"debug"`) {
+		t.Errorf("Expected no trace unless asked for, got %s", recorder.Body.String())
+	}
+}
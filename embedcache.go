@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/amikos-tech/chroma-go/types"
+)
+
+// embeddingEntry is one line of the cache file.
+type embeddingEntry struct {
+	Model  string    `json:"model"`
+	Hash   string    `json:"hash"`
+	Vector []float32 `json:"vector"`
+}
+
+// EmbeddingCache stores embeddings on disk keyed by model name and a hash of the
+// embedded text, so re-ingesting the schedule or asking a repeated question does not
+// call the embeddings API again. Entries are appended to a JSON-lines file. Several
+// processes may share the file; writes to it hold a lock on path + ".lock".
+type EmbeddingCache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string][]float32 // Keyed by model + "/" + hash
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// EmbeddingCacheStats reports cache use since the cache was opened and the number of
+// stored entries per model.
+type EmbeddingCacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries map[string]int
+}
+
+// OpenEmbeddingCache loads the cache file at path, which need not exist yet. A damaged
+// line, such as one cut short by a crash, is skipped.
+func OpenEmbeddingCache(path string) (*EmbeddingCache, error) {
+	cache := &EmbeddingCache{path: path, entries: make(map[string][]float32)}
+	if err := readEmbeddingEntries(path, cache.entries); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// readEmbeddingEntries adds the entries of the cache file at path to entries. A missing
+// file has none, and damaged lines are skipped.
+func readEmbeddingEntries(path string, entries map[string][]float32) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error opening embedding cache: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry embeddingEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Model == "" {
+			continue
+		}
+		entries[entry.Model+"/"+entry.Hash] = entry.Vector
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Error reading embedding cache: %w", err)
+	}
+	return nil
+}
+
+// lock takes the lock on the cache file shared by all processes using it, and returns
+// a function releasing it. The caller holds c.mu.
+func (c *EmbeddingCache) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(c.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Closing the file releases the lock
+	return func() { file.Close() }, nil
+}
+
+// embeddingCaches shares one cache per file between the collections of a process.
+var (
+	embeddingCachesMu sync.Mutex
+	embeddingCaches   = make(map[string]*EmbeddingCache)
+)
+
+// sharedEmbeddingCache returns the process-wide cache for path, opening it on first use.
+func sharedEmbeddingCache(path string) (*EmbeddingCache, error) {
+	embeddingCachesMu.Lock()
+	defer embeddingCachesMu.Unlock()
+	if cache, ok := embeddingCaches[path]; ok {
+		return cache, nil
+	}
+	cache, err := OpenEmbeddingCache(path)
+	if err != nil {
+		return nil, err
+	}
+	embeddingCaches[path] = cache
+	return cache, nil
+}
+
+// contentHash identifies embedded text.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached vector for text embedded with model.
+func (c *EmbeddingCache) lookup(model, text string) ([]float32, bool) {
+	c.mu.Lock()
+	vector, ok := c.entries[model+"/"+contentHash(text)]
+	c.mu.Unlock()
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return vector, ok
+}
+
+// store adds vectors for texts embedded with model and appends them to the cache file.
+func (c *EmbeddingCache) store(model string, texts []string, vectors [][]float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for i, text := range texts {
+		if vectors[i] == nil {
+			continue
+		}
+		entry := embeddingEntry{Model: model, Hash: contentHash(text), Vector: vectors[i]}
+		c.entries[entry.Model+"/"+entry.Hash] = entry.Vector
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Stats returns hit and miss counts and the number of entries per model.
+func (c *EmbeddingCache) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := EmbeddingCacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: make(map[string]int)}
+	for key := range c.entries {
+		model, _, _ := cutLast(key, "/")
+		stats.Entries[model]++
+	}
+	return stats
+}
+
+// Prune removes entries for every model except keepModel, rewriting the cache file,
+// and returns how many were removed. The file is read again under the lock, so entries
+// other processes appended since it was opened are kept.
+func (c *EmbeddingCache) Prune(keepModel string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unlock, err := c.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := readEmbeddingEntries(c.path, c.entries); err != nil {
+		return 0, err
+	}
+
+	var kept []embeddingEntry
+	removed := 0
+	for key, vector := range c.entries {
+		model, hash, _ := cutLast(key, "/")
+		if model != keepModel {
+			delete(c.entries, key)
+			removed++
+			continue
+		}
+		kept = append(kept, embeddingEntry{Model: model, Hash: hash, Vector: vector})
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Hash < kept[j].Hash })
+
+	// Write a new file and swap it in, so an interrupted prune leaves the old cache intact
+	tmp := c.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range kept {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return 0, err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmp, c.path)
+}
+
+// cutLast splits s around the last instance of sep, since model names may contain one.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// cachedEmbeddingFunction wraps an embedding function with an EmbeddingCache. Only
+// texts missing from the cache are sent to the wrapped function.
+type cachedEmbeddingFunction struct {
+	inner types.EmbeddingFunction
+	model string
+	cache *EmbeddingCache
+}
+
+// EmbedDocuments returns cached vectors and embeds the rest in one batch.
+func (e *cachedEmbeddingFunction) EmbedDocuments(ctx context.Context, texts []string) ([]*types.Embedding, error) {
+	embeddings := make([]*types.Embedding, len(texts))
+	var missing []string
+	var missingAt []int
+	for i, text := range texts {
+		if vector, ok := e.cache.lookup(e.model, text); ok {
+			embeddings[i] = types.NewEmbeddingFromFloat32(vector)
+			continue
+		}
+		missing = append(missing, text)
+		missingAt = append(missingAt, i)
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := e.inner.EmbedDocuments(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(computed) != len(missing) {
+		return nil, fmt.Errorf("embedding function returned %d vectors for %d texts", len(computed), len(missing))
+	}
+	vectors := make([][]float32, len(computed))
+	for i, embedding := range computed {
+		embeddings[missingAt[i]] = embedding
+		if embedding.ArrayOfFloat32 != nil {
+			vectors[i] = *embedding.ArrayOfFloat32
+		}
+	}
+	if err := e.cache.store(e.model, missing, vectors); err != nil {
+		// The vectors are still good; only later runs lose the benefit
+		slog.WarnContext(ctx, "Failed to write embedding cache", "err", err)
+	}
+	return embeddings, nil
+}
+
+// EmbedQuery embeds a single text through the cache.
+func (e *cachedEmbeddingFunction) EmbedQuery(ctx context.Context, text string) (*types.Embedding, error) {
+	embeddings, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedRecords embeds records that have no embedding yet.
+func (e *cachedEmbeddingFunction) EmbedRecords(ctx context.Context, records []*types.Record, force bool) error {
+	return types.EmbedRecordsDefaultImpl(e, ctx, records, force)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amikos-tech/chroma-go/types"
+)
+
+// countingEmbedder embeds each text as its length and counts the texts it was asked for.
+type countingEmbedder struct {
+	embedded int
+}
+
+func (e *countingEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]*types.Embedding, error) {
+	e.embedded += len(texts)
+	embeddings := make([]*types.Embedding, len(texts))
+	for i, text := range texts {
+		embeddings[i] = types.NewEmbeddingFromFloat32([]float32{float32(len(text)), 1})
+	}
+	return embeddings, nil
+}
+
+func (e *countingEmbedder) EmbedQuery(ctx context.Context, text string) (*types.Embedding, error) {
+	embeddings, err := e.EmbedDocuments(ctx, []string{text})
+	return embeddings[0], err
+}
+
+func (e *countingEmbedder) EmbedRecords(ctx context.Context, records []*types.Record, force bool) error {
+	return types.EmbedRecordsDefaultImpl(e, ctx, records, force)
+}
+
+func TestEmbeddingCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "embeddings.jsonl")
+	cache, err := OpenEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingEmbedder{}
+	ef := &cachedEmbeddingFunction{inner: inner, model: "text-embedding-ada-002", cache: cache}
+
+	ctx := context.Background()
+	if _, err := ef.EmbedDocuments(ctx, []string{"CS 110", "CS 272"}); err != nil {
+		t.Fatal(err)
+	}
+	embeddings, err := ef.EmbedDocuments(ctx, []string{"CS 272", "MATH 109"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.embedded != 3 {
+		t.Errorf("Expected only uncached texts to be embedded, embedded %d", inner.embedded)
+	}
+	if got := (*embeddings[0].ArrayOfFloat32)[0]; got != 6 {
+		t.Errorf("Expected the cached vector for CS 272, got %v", got)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("Expected 1 hit and 3 misses, got %+v", stats)
+	}
+
+	// Entries survive a restart, and another model does not share them.
+	reopened, err := OpenEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := &cachedEmbeddingFunction{inner: inner, model: "text-embedding-3-small", cache: reopened}
+	if _, err := other.EmbedQuery(ctx, "CS 110"); err != nil {
+		t.Fatal(err)
+	}
+	if inner.embedded != 4 {
+		t.Errorf("Expected a new model to miss the cache, embedded %d", inner.embedded)
+	}
+	if stats := reopened.Stats(); stats.Entries["text-embedding-ada-002"] != 3 || stats.Entries["text-embedding-3-small"] != 1 {
+		t.Errorf("Unexpected entries after reopening: %v", stats.Entries)
+	}
+
+	removed, err := reopened.Prune("text-embedding-3-small")
+	if err != nil || removed != 3 {
+		t.Fatalf("Expected 3 entries pruned, got %d, %v", removed, err)
+	}
+	pruned, err := OpenEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := pruned.Stats(); len(stats.Entries) != 1 || stats.Entries["text-embedding-3-small"] != 1 {
+		t.Errorf("Expected only the kept model on disk, got %v", stats.Entries)
+	}
+}
+
+func TestEmbeddingCachePruneKeepsOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.jsonl")
+	pruner, err := OpenEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pruner.store("text-embedding-ada-002", []string{"CS 110"}, [][]float32{{1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process appends to the file after the pruning one opened it
+	writer, err := OpenEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.store("text-embedding-3-small", []string{"CS 272"}, [][]float32{{2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := pruner.Prune("text-embedding-3-small"); err != nil || removed != 1 {
+		t.Fatalf("Expected 1 entry pruned, got %d, %v", removed, err)
+	}
+	reopened, err := OpenEmbeddingCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vector, ok := reopened.lookup("text-embedding-3-small", "CS 272"); !ok || vector[0] != 2 {
+		t.Errorf("Expected the other process's entry to survive the prune, got %v, %v", vector, ok)
+	}
+	if stats := reopened.Stats(); len(stats.Entries) != 1 {
+		t.Errorf("Expected only the kept model on disk, got %v", stats.Entries)
+	}
+}
+
+func TestCacheCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.jsonl")
+	lines := `{"model":"text-embedding-ada-002","hash":"a","vector":[1]}
+{"model":"text-embedding-3-small","hash":"b","vector":[2]}
+{"model":"text-embedding-3-small","hash":"c","vec`
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CATALOG_EMBED_CACHE", path)
+
+	var out bytes.Buffer
+	if err := run([]string{"cache", "stats", "--store", "memory"}, &out); err != nil {
+		t.Fatalf("cache stats failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "text-embedding-3-small: 1 entries") {
+		t.Errorf("Expected the damaged line to be skipped:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"cache", "prune", "--store", "memory"}, &out); err != nil {
+		t.Fatalf("cache prune failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Removed 1 cached embeddings") {
+		t.Errorf("Unexpected prune output:\n%s", out.String())
+	}
+}
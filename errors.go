@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMissingAPIKey is returned when no OpenAI API key is configured.
+var ErrMissingAPIKey = errors.New("API key is missing. Please set OPENAI_PROJECT_KEY environment variable or openai.api_key in the config file.")
+
+// ErrStoreUnavailable matches every StoreError, for callers that only need to know
+// whether the vector store could be used.
+var ErrStoreUnavailable = errors.New("vector store unavailable")
+
+// ErrBudgetExceeded is returned when a usage budget is exhausted and no cheaper model
+// is configured to fall back to.
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// StoreError reports a failed vector store operation, such as connecting to ChromaDB,
+// creating the embedding function or querying a collection.
+type StoreError struct {
+	Op         string // Operation that failed, e.g. "connect" or "query"
+	Collection string // Collection involved, if any
+	Err        error
+}
+
+func (e *StoreError) Error() string {
+	if e.Collection != "" {
+		return fmt.Sprintf("vector store %s %s: %v", e.Op, e.Collection, e.Err)
+	}
+	return fmt.Sprintf("vector store %s: %v", e.Op, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrStoreUnavailable) true for any StoreError.
+func (e *StoreError) Is(target error) bool {
+	return target == ErrStoreUnavailable
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	"github.com/amikos-tech/chroma-go/types"
+)
+
+// constantEmbedder embeds every text as the same vector, so queries reach the store
+// without calling OpenAI.
+type constantEmbedder struct{}
+
+func (constantEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([]*types.Embedding, error) {
+	embeddings := make([]*types.Embedding, len(texts))
+	for i := range texts {
+		embeddings[i] = types.NewEmbeddingFromFloat32([]float32{1, 0})
+	}
+	return embeddings, nil
+}
+
+func (constantEmbedder) EmbedQuery(ctx context.Context, text string) (*types.Embedding, error) {
+	return types.NewEmbeddingFromFloat32([]float32{1, 0}), nil
+}
+
+func (e constantEmbedder) EmbedRecords(ctx context.Context, records []*types.Record, force bool) error {
+	return types.EmbedRecordsDefaultImpl(e, ctx, records, force)
+}
+
+// unreachableURL returns the address of a port that was just closed.
+func unreachableURL(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "http://" + addr
+}
+
+func TestAddStoreUnavailable(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Chroma.URL = unreachableURL(t)
+
+	if _, _, _, err := Add(context.Background(), cfg, nil); !errors.Is(err, ErrMissingAPIKey) {
+		t.Errorf("Expected ErrMissingAPIKey without a key, got %v", err)
+	}
+
+	cfg.OpenAI.APIKey = "sk-test"
+	_, courses, _, err := Add(context.Background(), cfg, nil)
+	if !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("Expected ErrStoreUnavailable, got %v", err)
+	}
+	var storeErr *StoreError
+	if !errors.As(err, &storeErr) || storeErr.Op == "" {
+		t.Errorf("Expected a *StoreError naming the operation, got %#v", err)
+	}
+	if courses != nil {
+		t.Error("Expected no collection when the store is down")
+	}
+}
+
+func TestQueryFallsBackWhenStoreDown(t *testing.T) {
+	client, err := chroma.NewClient(unreachableURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := chroma.NewCollection(client.ApiClient, "id", "courses-collection", nil, constantEmbedder{}, types.DefaultTenant, types.DefaultDatabase)
+
+	if _, err := Query(context.Background(), client, collection, "CS 272", 5); !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("Expected ErrStoreUnavailable from Query, got %v", err)
+	}
+
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+		{Subject: "MATH", CourseNumber: "109", CRN: "3", Title: "Calculus"},
+	}
+	bot := NewChatBot(NewLLMClient("sk-test"), &MetadataExtractor{courses: courses}, client, collection, collection)
+
+	documents, err := bot.retrieve(context.Background(), collection, "Who teaches CS 272?")
+	if err != nil {
+		t.Fatalf("Expected the fallback to succeed, got %v", err)
+	}
+	if len(documents) != 1 || documents[0].ID != "1" {
+		t.Errorf("Expected the in-process match for CS 272, got %v", documents)
+	}
+	if !errors.Is(bot.Degraded(), ErrStoreUnavailable) {
+		t.Errorf("Expected the chatbot to report the degraded state, got %v", bot.Degraded())
+	}
+
+	if answer := bot.QueryCourses(context.Background(), "Phil Peterson", TableStyle{}); !strings.Contains(answer, "Software Development") {
+		t.Errorf("Expected QueryCourses to fall back to the schedule, got %q", answer)
+	}
+	if notice := storeNotice(nil, bot.Degraded()); !strings.Contains(notice, "in-process course data") {
+		t.Errorf("Unexpected degraded notice %q", notice)
+	}
+	if notice := storeNotice(bot.Degraded(), nil); notice == "" {
+		t.Error("Expected a notice when the store recovers")
+	}
+}
+
+func TestStoreRecovers(t *testing.T) {
+	client, err := chroma.NewClient(unreachableURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := chroma.NewCollection(client.ApiClient, "id", "courses-collection", nil, constantEmbedder{}, types.DefaultTenant, types.DefaultDatabase)
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	bot := NewChatBot(NewLLMClient("sk-test"), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	bot.SetClock(fixedClock(testNow))
+	bot.SetDegraded(ErrStoreUnavailable)
+
+	var attempts atomic.Int32
+	bot.SetStoreConnector(func(ctx context.Context) (vectorStore, error) {
+		if attempts.Add(1) == 1 {
+			return vectorStore{}, &StoreError{Op: "connect", Err: ErrStoreUnavailable}
+		}
+		return vectorStore{client: client, courses: collection, instructors: collection}, nil
+	})
+	// ask answers from the schedule and waits for the reconnection it started, if any
+	ask := func() {
+		if answer := bot.QueryCourses(context.Background(), "Phil Peterson", TableStyle{}); !strings.Contains(answer, "Software Development") {
+			t.Errorf("Expected the courses from the schedule, got %q", answer)
+		}
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			bot.storeMu.Lock()
+			connecting := bot.connecting
+			bot.storeMu.Unlock()
+			if !connecting {
+				return
+			}
+		}
+		t.Fatal("Expected the reconnection to finish")
+	}
+
+	ask()
+	if attempts.Load() != 1 || bot.Degraded() == nil {
+		t.Fatalf("Expected a failed attempt to keep the chatbot degraded, got %d attempts and %v", attempts.Load(), bot.Degraded())
+	}
+	ask()
+	if attempts.Load() != 1 {
+		t.Errorf("Expected no new attempt within %v, got %d", storeRetryInterval, attempts.Load())
+	}
+
+	bot.SetClock(fixedClock(testNow.Add(storeRetryInterval)))
+	ask()
+	if attempts.Load() != 2 || bot.Degraded() != nil || bot.vectorStore().courses != collection {
+		t.Errorf("Expected the store to be used again once it is reachable, got %d attempts and %v", attempts.Load(), bot.Degraded())
+	}
+}
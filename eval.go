@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EvalSuite is a YAML file of golden questions for the eval command.
+type EvalSuite struct {
+	K         int        `yaml:"k"` // Documents considered for recall@k; zero uses --k
+	Questions []EvalCase `yaml:"questions"`
+}
+
+// EvalCase is one golden question with the facts a correct answer states and the
+// documents retrieval should find.
+type EvalCase struct {
+	ID        string   `yaml:"id"`
+	Question  string   `yaml:"question"`
+	Facts     []string `yaml:"facts"`     // CRNs, instructor names, rooms, emails, ... expected in the answer
+	Documents []string `yaml:"documents"` // CRNs or document IDs expected among the top k retrieved
+}
+
+// EvalResult scores the answer to one question.
+type EvalResult struct {
+	ID                string   `json:"id"`
+	Question          string   `json:"question"`
+	Answer            string   `json:"answer"`
+	Error             string   `json:"error,omitempty"`
+	FactsExpected     int      `json:"facts_expected"`
+	FactsFound        int      `json:"facts_found"`
+	MissingFacts      []string `json:"missing_facts,omitempty"`
+	DocumentsExpected int      `json:"documents_expected"`
+	DocumentsFound    int      `json:"documents_found"`
+	MissingDocuments  []string `json:"missing_documents,omitempty"`
+	Entities          int      `json:"entities"`
+	Hallucinated      []string `json:"hallucinated,omitempty"`
+}
+
+// EvalSummary totals the scores over all questions. Rates are fractions of the totals,
+// so questions with more facts weigh more.
+type EvalSummary struct {
+	Questions         int     `json:"questions"`
+	Errors            int     `json:"errors"`
+	FactRecall        float64 `json:"fact_recall"`        // Expected facts stated in answers
+	RecallAtK         float64 `json:"recall_at_k"`        // Expected documents among the top k retrieved
+	HallucinationRate float64 `json:"hallucination_rate"` // Entities in answers that are not in the schedule
+}
+
+// EvalReport is written by the eval command. It holds no timings or timestamps, so
+// reports of two runs can be diffed.
+type EvalReport struct {
+	Model   string       `json:"model"`
+	Prompts string       `json:"prompts"` // Prompt template versions, see Prompts.Version
+	K       int          `json:"k"`
+	Summary EvalSummary  `json:"summary"`
+	Results []EvalResult `json:"results"`
+}
+
+// LoadEvalSuite reads golden questions from a YAML file.
+func LoadEvalSuite(path string) (*EvalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read eval file: %w", err)
+	}
+	var suite EvalSuite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("Error parsing eval file %s: %w", path, err)
+	}
+	if len(suite.Questions) == 0 {
+		return nil, fmt.Errorf("eval file %s has no questions", path)
+	}
+	for i, c := range suite.Questions {
+		if strings.TrimSpace(c.Question) == "" {
+			return nil, fmt.Errorf("eval file %s: question %d is empty", path, i+1)
+		}
+		if c.ID == "" {
+			suite.Questions[i].ID = fmt.Sprintf("q%d", i+1)
+		}
+	}
+	return &suite, nil
+}
+
+// RunEval answers every question in its own conversation, without the answer cache, and
+// scores the answers against the schedule the chatbot was built from. Cancelling ctx
+// stops the run.
+func RunEval(ctx context.Context, bot *ChatBot, suite *EvalSuite, k int) (*EvalReport, error) {
+	if suite.K > 0 {
+		k = suite.K
+	}
+	known := knownEntities(bot.metadata.courses)
+	codes := scheduleCodes(bot.metadata.courses)
+	report := &EvalReport{Model: bot.llmClient.model, Prompts: bot.prompts.Version(), K: k}
+
+	var facts, factsFound, documents, documentsFound, entities, hallucinated int
+	for _, c := range suite.Questions {
+		questionCtx, details := WithAnswerDetails(WithoutAnswerCache(ctx))
+		answer, err := bot.Answer(questionCtx, NewSession("eval-"+c.ID), c.Question)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		result := EvalResult{ID: c.ID, Question: c.Question, Answer: answer, FactsExpected: len(c.Facts), DocumentsExpected: len(c.Documents)}
+		if err != nil {
+			result.Error = err.Error()
+			report.Summary.Errors++
+		}
+		for _, fact := range c.Facts {
+			if containsFold(answer, fact) {
+				result.FactsFound++
+			} else {
+				result.MissingFacts = append(result.MissingFacts, fact)
+			}
+		}
+		// Recall counts what retrieval ranked in the top k, whether or not it was close
+		// enough to be given to the model
+		top := details.Retrieved
+		if len(top) > k {
+			top = top[:k]
+		}
+		for _, want := range c.Documents {
+			if retrievedDocument(top, want) {
+				result.DocumentsFound++
+			} else {
+				result.MissingDocuments = append(result.MissingDocuments, want)
+			}
+		}
+		for _, entity := range answerEntities(answer, codes) {
+			result.Entities++
+			if !known[entity] {
+				result.Hallucinated = append(result.Hallucinated, entity)
+			}
+		}
+
+		facts += result.FactsExpected
+		factsFound += result.FactsFound
+		documents += result.DocumentsExpected
+		documentsFound += result.DocumentsFound
+		entities += result.Entities
+		hallucinated += len(result.Hallucinated)
+		report.Results = append(report.Results, result)
+	}
+
+	report.Summary.Questions = len(report.Results)
+	report.Summary.FactRecall = ratio(factsFound, facts)
+	report.Summary.RecallAtK = ratio(documentsFound, documents)
+	report.Summary.HallucinationRate = ratio(hallucinated, entities)
+	return report, nil
+}
+
+// ratio is n/d, or 0 if there is nothing to divide.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// containsFold reports whether s contains substr, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// retrievedDocument reports whether a document with the given ID, or containing it as a
+// value such as a CRN, was retrieved.
+func retrievedDocument(documents []TracedDocument, want string) bool {
+	for _, doc := range documents {
+		if doc.ID == want || strings.Contains(doc.Text, `"`+want+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// Entities that answers state and the schedule can confirm.
+var (
+	crnPattern        = regexp.MustCompile(`\b\d{5}\b`)
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	entityCodePattern = regexp.MustCompile(`\b([A-Z&]{2,5}) ?-?(\d{2,3}[A-Z]?|G\d{2})\b`)
+	dayCodePattern    = regexp.MustCompile(`^[MTWRFSU]+$`)
+)
+
+// answerEntities extracts the CRNs, emails, course codes and rooms stated in an answer,
+// normalized as knownEntities keys them. Course codes and rooms share a shape, such as
+// CS 110 and LS 210, so both are matched by one pattern. Meeting times such as "MWF 10:30"
+// share it too; they are told apart by the colon, and by day codes that are not among the
+// schedule's subject and building codes.
+func answerEntities(answer string, codes map[string]bool) []string {
+	var entities []string
+	seen := make(map[string]bool)
+	add := func(entity string) {
+		if !seen[entity] {
+			seen[entity] = true
+			entities = append(entities, entity)
+		}
+	}
+	withoutEmails := emailPattern.ReplaceAllStringFunc(answer, func(email string) string {
+		add(strings.ToLower(email))
+		return " "
+	})
+	for _, crn := range crnPattern.FindAllString(withoutEmails, -1) {
+		add(crn)
+	}
+	for _, match := range entityCodePattern.FindAllStringSubmatchIndex(withoutEmails, -1) {
+		code, number := withoutEmails[match[2]:match[3]], withoutEmails[match[4]:match[5]]
+		if strings.HasPrefix(withoutEmails[match[1]:], ":") || (dayCodePattern.MatchString(code) && !codes[code]) {
+			continue
+		}
+		add(code + " " + number)
+	}
+	return entities
+}
+
+// knownEntities collects every CRN, email, course code and room in the schedule.
+func knownEntities(courses []Course) map[string]bool {
+	known := make(map[string]bool)
+	for _, course := range courses {
+		known[course.CRN] = true
+		known[strings.ToLower(course.InstructorEmail)] = true
+		known[strings.ToUpper(course.Subject)+" "+strings.ToUpper(course.CourseNumber)] = true
+		if course.Building != "" && course.Room != "" {
+			known[strings.ToUpper(course.Building)+" "+strings.ToUpper(course.Room)] = true
+		}
+	}
+	return known
+}
+
+// scheduleCodes collects the subject and building codes in the schedule.
+func scheduleCodes(courses []Course) map[string]bool {
+	codes := make(map[string]bool)
+	for _, course := range courses {
+		codes[strings.ToUpper(course.Subject)] = true
+		if course.Building != "" {
+			codes[strings.ToUpper(course.Building)] = true
+		}
+	}
+	return codes
+}
+
+// writeEvalMarkdown writes the report as Markdown tables.
+func writeEvalMarkdown(w io.Writer, report *EvalReport) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Eval report\n\nModel: %s\n\nPrompts: %s\n\n", report.Model, report.Prompts)
+	fmt.Fprintf(&b, "| Questions | Errors | Fact recall | Recall@%d | Hallucination rate |\n", report.K)
+	b.WriteString("|---|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| %d | %d | %.1f%% | %.1f%% | %.1f%% |\n\n", report.Summary.Questions, report.Summary.Errors,
+		100*report.Summary.FactRecall, 100*report.Summary.RecallAtK, 100*report.Summary.HallucinationRate)
+
+	b.WriteString("| ID | Question | Facts | Documents | Hallucinated | Notes |\n")
+	b.WriteString("|---|---|---|---|---|---|\n")
+	for _, r := range report.Results {
+		var notes []string
+		if r.Error != "" {
+			notes = append(notes, "error: "+r.Error)
+		}
+		if len(r.MissingFacts) > 0 {
+			notes = append(notes, "missing facts: "+strings.Join(r.MissingFacts, ", "))
+		}
+		if len(r.MissingDocuments) > 0 {
+			notes = append(notes, "missing documents: "+strings.Join(r.MissingDocuments, ", "))
+		}
+		if len(r.Hallucinated) > 0 {
+			notes = append(notes, "unknown: "+strings.Join(r.Hallucinated, ", "))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %d/%d | %d/%d | %d/%d | %s |\n", r.ID, markdownCell(r.Question),
+			r.FactsFound, r.FactsExpected, r.DocumentsFound, r.DocumentsExpected, len(r.Hallucinated), r.Entities,
+			markdownCell(strings.Join(notes, "; ")))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownCell escapes text for a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// scriptedLLM is a stand-in model that gives a fixed answer to each question.
+func scriptedLLM(t *testing.T, answers map[string]string) *LLMClient {
+	return newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeCompletionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var question string
+		for _, message := range req.Messages {
+			if message.Role == openai.ChatMessageRoleUser {
+				question = message.Content
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answers[question]},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	})
+}
+
+func TestRunEval(t *testing.T) {
+	suite, err := LoadEvalSuite("testdata/eval/golden.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := NewMetadataExtractor("Fall 2024 Class Schedule 08082024.csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llm := scriptedLLM(t, map[string]string{
+		"Who teaches AAS 100?":                            "AAS 100 (CRN 42180) is taught by Sheryl Davis in LM 140.",
+		"What is the email of the instructor of AAS 100?": "You can reach Sheryl Davis at sedavis2@usfca.edu.",
+		"What does Phil Peterson teach?":                  "Philip Peterson teaches CS 272 Software Development in LS G12.",
+		"Where does CS 112 section 01 meet?":              "CS 112 section 01 meets in MH 999.",
+		"What is the CRN of CS 110 section 03?":           "The CRN is 40632, taught by Kelsey Urgo. See also CRN 99999.",
+	})
+	chatbot := NewChatBot(llm, metadata, nil, nil, nil)
+
+	report, err := RunEval(context.Background(), chatbot, suite, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.K != 5 || report.Summary.Questions != 5 || report.Summary.Errors != 0 {
+		t.Fatalf("Unexpected summary: %+v", report)
+	}
+	// 6 of 7 facts: the room of CS 112 is wrong
+	if got := report.Summary.FactRecall; got != 6.0/7 {
+		t.Errorf("Expected fact recall 6/7, got %v", got)
+	}
+	// MH 999 and CRN 99999 are not in the schedule
+	room := report.Results[3]
+	if strings.Join(room.MissingFacts, ",") != "MH 122" || strings.Join(room.Hallucinated, ",") != "MH 999" {
+		t.Errorf("Expected the wrong room to be missing and hallucinated, got %+v", room)
+	}
+	if crn := report.Results[4]; strings.Join(crn.Hallucinated, ",") != "99999" {
+		t.Errorf("Expected the unknown CRN to be hallucinated, got %+v", crn)
+	}
+	if report.Summary.HallucinationRate <= 0 || report.Summary.HallucinationRate >= 0.5 {
+		t.Errorf("Unexpected hallucination rate %v", report.Summary.HallucinationRate)
+	}
+	if alias := report.Results[2]; alias.DocumentsFound != 2 {
+		t.Errorf("Expected the alias question to retrieve both CS 272 sections, got %+v", alias)
+	}
+
+	var markdown strings.Builder
+	if err := writeEvalMarkdown(&markdown, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"| Recall@5 |", "| room | Where does CS 112 section 01 meet? | 0/1 |", "unknown: MH 999"} {
+		if !strings.Contains(markdown.String(), want) {
+			t.Errorf("Expected %q in the Markdown report:\n%s", want, markdown.String())
+		}
+	}
+}
+
+func TestAnswerEntities(t *testing.T) {
+	codes := map[string]bool{"CS": true, "MS": true, "LS": true}
+	answer := "CS 110 (CRN 40630) meets MWF 10:30-11:35 in LS G12, and MS 101 meets TR 9:55. Email jdoe@usfca.edu or see MW 10."
+	want := "jdoe@usfca.edu|40630|CS 110|LS G12|MS 101"
+	if got := strings.Join(answerEntities(answer, codes), "|"); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
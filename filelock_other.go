@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// lockFile is only supported on Linux; elsewhere processes sharing a cache file are not
+// kept from writing it at the same time.
+func lockFile(file *os.File) error {
+	return nil
+}
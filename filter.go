@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// CourseFilter selects schedule rows by their fields. Empty fields match everything.
+type CourseFilter struct {
+	Subject    string // Subject code, e.g. "CS"
+	Number     string // Course number, e.g. "272"
+	Days       string // Day codes that must all be meeting days, e.g. "TR"
+	Instructor string // Instructor name or alias, matched case-insensitively as a substring
+	Building   string // Building code, e.g. "LS"
+	Title      string // Word or phrase in the title
+}
+
+// Matches reports whether the course satisfies every set field of the filter.
+func (f CourseFilter) Matches(course Course) bool {
+	if f.Subject != "" && !strings.EqualFold(f.Subject, course.Subject) {
+		return false
+	}
+	if f.Number != "" && !strings.EqualFold(f.Number, course.CourseNumber) {
+		return false
+	}
+	for _, day := range strings.ToUpper(f.Days) {
+		if !strings.ContainsRune(course.MeetDays, day) {
+			return false
+		}
+	}
+	if f.Building != "" && !strings.EqualFold(f.Building, course.Building) {
+		return false
+	}
+	if f.Title != "" && !strings.Contains(strings.ToLower(course.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+	if f.Instructor != "" {
+		name := strings.ToLower(instructorName(course))
+		raw := strings.ToLower(course.InstructorFirstName + " " + course.InstructorLastName)
+		wanted := strings.ToLower(f.Instructor)
+		if canonical := findAliasCanonical(f.Instructor); canonical != "" {
+			wanted = strings.ToLower(canonical)
+		}
+		if !strings.Contains(name, wanted) && !strings.Contains(raw, wanted) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterCourses returns the courses matching the filter, in schedule order.
+func FilterCourses(courses []Course, filter CourseFilter) []Course {
+	var matches []Course
+	for _, course := range courses {
+		if filter.Matches(course) {
+			matches = append(matches, course)
+		}
+	}
+	return matches
+}
+
+// findAliasCanonical returns the canonical name for an exact alias, or "".
+func findAliasCanonical(name string) string {
+	for _, instructor := range InitializeInstructors() {
+		for _, alias := range instructor.Aliases {
+			if strings.EqualFold(strings.TrimSpace(name), alias) {
+				return instructor.CanonicalName
+			}
+		}
+	}
+	return ""
+}
+
+// localRetrieve finds schedule rows relevant to a question without a vector store, by
+// scoring mentioned course codes, instructor names, subjects, buildings and title words.
+// Results are formatted like the courses collection so they can stand in for Query.
+func localRetrieve(question string, courses []Course, limit int) []RetrievedDocument {
+	lower := strings.ToLower(question)
+	subjects, buildings := scheduleFilters(question, courses)
+	codes := make(map[string]bool)
+	for _, match := range courseCodePattern.FindAllStringSubmatch(question, -1) {
+		codes[normalizeCourseCode(match[1]+" "+match[2])] = true
+	}
+	terms := searchTerms(question)
+
+	type scored struct {
+		course Course
+		score  int
+	}
+	var matches []scored
+	for _, course := range courses {
+		score := 0
+		if codes[courseCode(course)] {
+			score += 4
+		}
+		if name := strings.ToLower(instructorName(course)); name != "" {
+			lastName := strings.ToLower(course.InstructorLastName)
+			if strings.Contains(lower, name) || (lastName != "" && containsWord(lower, lastName)) {
+				score += 3
+			}
+		}
+		if subjects[strings.ToUpper(course.Subject)] {
+			score++
+		}
+		if buildings[course.Building] {
+			score++
+		}
+		title := strings.ToLower(course.Title)
+		for _, term := range terms {
+			if len(term) > 3 && strings.Contains(title, term) {
+				score++
+			}
+		}
+		if score > 1 || (score == 1 && len(codes) == 0) {
+			matches = append(matches, scored{course, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	var documents []RetrievedDocument
+	for _, match := range matches {
+		if len(documents) == limit {
+			break
+		}
+		jsonData, err := json.Marshal(match.course)
+		if err != nil {
+			continue
+		}
+		documents = append(documents, RetrievedDocument{
+			ID:       match.course.CRN,
+			Document: string(jsonData),
+			Metadata: map[string]interface{}{"instructor_canonical_name": instructorName(match.course)},
+		})
+	}
+	return documents
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	chromaopenai "github.com/amikos-tech/chroma-go/openai"
+)
+
+// httpTransport carries every request to OpenAI and Chroma. It is replaced to record or
+// replay fixtures.
+var httpTransport http.RoundTripper = http.DefaultTransport
+
+// newHTTPClient returns a client using httpTransport.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: httpTransport}
+}
+
+// newChromaClient connects to Chroma through httpTransport.
+func newChromaClient(url string) (*chroma.Client, error) {
+	client, err := chroma.NewClient(url)
+	if err != nil {
+		return nil, err
+	}
+	client.ApiClient.GetConfig().HTTPClient = newHTTPClient()
+	return client, nil
+}
+
+// withEmbeddingHTTPClient makes the OpenAI embedding function use httpTransport.
+func withEmbeddingHTTPClient() chromaopenai.Option {
+	return func(c *chromaopenai.OpenAIClient) error {
+		c.Client = newHTTPClient()
+		return nil
+	}
+}
+
+// Fixture modes, selected with $CATALOG_FIXTURES.
+const (
+	fixturesRecord = "record" // Call the real services and save each exchange
+	fixturesReplay = "replay" // Serve saved exchanges and never touch the network
+)
+
+// defaultFixturesDir holds fixtures unless $CATALOG_FIXTURES_DIR names another directory.
+const defaultFixturesDir = "testdata/fixtures"
+
+// replayAPIKey stands in for the OpenAI API key when replaying, as nothing is sent.
+const replayAPIKey = "sk-replay"
+
+// ErrFixtureMissing is returned in replay mode for a request that was never recorded.
+var ErrFixtureMissing = errors.New("no recorded fixture for request")
+
+// useFixturesFromEnv records or replays OpenAI and Chroma traffic if $CATALOG_FIXTURES
+// asks for it, and reports the mode in effect ("" for the network).
+func useFixturesFromEnv() (string, error) {
+	mode := os.Getenv("CATALOG_FIXTURES")
+	if mode == "" {
+		return "", nil
+	}
+	transport, err := NewFixtureTransport(mode, fixturesDir(), http.DefaultTransport)
+	if err != nil {
+		return "", err
+	}
+	httpTransport = transport
+	return mode, nil
+}
+
+// fixturesDir returns where fixtures are recorded and replayed from: $CATALOG_FIXTURES_DIR,
+// or testdata/fixtures.
+func fixturesDir() string {
+	if dir := os.Getenv("CATALOG_FIXTURES_DIR"); dir != "" {
+		return dir
+	}
+	return defaultFixturesDir
+}
+
+// FixtureTransport records HTTP exchanges to fixture files or replays them. Requests are
+// matched by method, path, query and body, ignoring the host and headers, so fixtures
+// work against any server address and never contain API keys. A request made several
+// times is answered with the recorded responses in order, repeating the last, so
+// stateful services like Chroma replay faithfully.
+type FixtureTransport struct {
+	mode  string
+	dir   string
+	inner http.RoundTripper
+
+	mu       sync.Mutex
+	recorded map[string]*fixture // Exchanges recorded by this transport, by key
+	replayed map[string]int      // Responses served so far, by key
+}
+
+// fixture is the file saved for one request.
+type fixture struct {
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Body      json.RawMessage   `json:"body,omitempty"`
+	Responses []fixtureResponse `json:"responses"`
+}
+
+// fixtureResponse is one recorded response.
+type fixtureResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"` // JSON bodies, kept readable
+	Text        string          `json:"text,omitempty"` // Any other body
+}
+
+// NewFixtureTransport records through inner to, or replays from, fixture files in dir.
+func NewFixtureTransport(mode, dir string, inner http.RoundTripper) (*FixtureTransport, error) {
+	if mode != fixturesRecord && mode != fixturesReplay {
+		return nil, fmt.Errorf("CATALOG_FIXTURES must be %s or %s, got %q", fixturesRecord, fixturesReplay, mode)
+	}
+	if mode == fixturesRecord {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("Failed to create fixtures directory: %w", err)
+		}
+	}
+	return &FixtureTransport{mode: mode, dir: dir, inner: inner, recorded: make(map[string]*fixture), replayed: make(map[string]int)}, nil
+}
+
+// RoundTrip records or replays one exchange.
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	body = canonicalJSON(body)
+	path := req.URL.Path
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	key := fixtureKey(req.Method, path, body)
+
+	if t.mode == fixturesReplay {
+		return t.replay(req, key, path)
+	}
+	return t.record(req, key, path, body)
+}
+
+// replay serves the next recorded response for key.
+func (t *FixtureTransport) replay(req *http.Request, key, path string) (*http.Response, error) {
+	data, err := os.ReadFile(filepath.Join(t.dir, key+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s (looked for %s in %s; record it with CATALOG_FIXTURES=record)",
+			ErrFixtureMissing, req.Method, path, key+".json", t.dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved fixture
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("Damaged fixture %s: %w", key, err)
+	}
+	if len(saved.Responses) == 0 {
+		return nil, fmt.Errorf("%w: %s %s (%s has no responses)", ErrFixtureMissing, req.Method, path, key+".json")
+	}
+
+	t.mu.Lock()
+	n := min(t.replayed[key], len(saved.Responses)-1)
+	t.replayed[key]++
+	t.mu.Unlock()
+	return saved.Responses[n].response(req), nil
+}
+
+// record makes the request and appends the response to the fixture for key. The first
+// time a transport records a key it starts the fixture afresh.
+func (t *FixtureTransport) record(req *http.Request, key, path string, body []byte) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	saved, ok := t.recorded[key]
+	if !ok {
+		saved = &fixture{Method: req.Method, Path: path}
+		if len(body) > 0 {
+			saved.Body = rawJSON(body)
+		}
+		t.recorded[key] = saved
+	}
+	recorded := fixtureResponse{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+	if json.Valid(respBody) {
+		recorded.Body = canonicalJSON(respBody)
+	} else {
+		recorded.Text = string(respBody)
+	}
+	saved.Responses = append(saved.Responses, recorded)
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(t.dir, key+".json"), append(data, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("Failed to save fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// response rebuilds a recorded response for req.
+func (r fixtureResponse) response(req *http.Request) *http.Response {
+	body := []byte(r.Body)
+	if r.Body == nil {
+		body = []byte(r.Text)
+	}
+	header := make(http.Header)
+	if r.ContentType != "" {
+		header.Set("Content-Type", r.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// fixtureKey names the fixture file of a request: a readable form of the path followed
+// by a hash of everything that identifies the request.
+func fixtureKey(method, path string, body []byte) string {
+	sum := sha256.Sum256([]byte(method + " " + path + "\n" + string(body)))
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, path), "-")
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	return strings.ToLower(method) + "-" + name + "-" + hex.EncodeToString(sum[:6])
+}
+
+// canonicalJSON re-encodes a JSON body with sorted keys so equivalent requests match.
+// Other bodies are returned unchanged.
+func canonicalJSON(body []byte) []byte {
+	var value any
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return body
+	}
+	canonical, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// rawJSON keeps a JSON body readable in the fixture, or stores anything else as a string.
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	quoted, _ := json.Marshal(string(body))
+	return json.RawMessage(quoted)
+}
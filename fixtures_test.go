@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestFixtureRecordReplay(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.URL.Path == "/api/v1/version" {
+			w.Write([]byte(`"0.5.0"`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Call %d"},"finish_reason":"stop"}]}`, n)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	ask := func(transport http.RoundTripper, baseURL string) (string, error) {
+		config := openai.DefaultConfig("sk-secret")
+		config.BaseURL = baseURL + "/v1"
+		config.HTTPClient = &http.Client{Transport: transport}
+		response, err := openai.NewClientWithConfig(config).CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+			Model:    openai.GPT4oMini,
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Who teaches CS 110?"}},
+		})
+		if err != nil {
+			return "", err
+		}
+		return response.Choices[0].Message.Content, nil
+	}
+	version := func(transport http.RoundTripper, baseURL string) string {
+		response, err := (&http.Client{Transport: transport}).Get(baseURL + "/api/v1/version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return string(body)
+	}
+
+	recorder, err := NewFixtureTransport(fixturesRecord, dir, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Call 1", "Call 2"} {
+		if got, err := ask(recorder, server.URL); err != nil || got != want {
+			t.Fatalf("Expected %q while recording, got %q, %v", want, got, err)
+		}
+	}
+	if got := version(recorder, server.URL); got != `"0.5.0"` {
+		t.Fatalf("Expected the version while recording, got %q", got)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("Expected a fixture per distinct request, got %v", files)
+	}
+	for _, file := range files {
+		if data, _ := os.ReadFile(file); strings.Contains(string(data), "sk-secret") {
+			t.Errorf("Expected %s not to contain the API key", file)
+		}
+	}
+
+	// Replaying needs neither the server nor the key it was recorded with
+	player, err := NewFixtureTransport(fixturesReplay, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const elsewhere = "http://replay.invalid"
+	for _, want := range []string{"Call 1", "Call 2", "Call 2"} {
+		if got, err := ask(player, elsewhere); err != nil || got != want {
+			t.Errorf("Expected %q on replay, got %q, %v", want, got, err)
+		}
+	}
+	if got := version(player, elsewhere); got != `"0.5.0"` {
+		t.Errorf("Expected the recorded version, got %q", got)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected replay not to reach the server, got %d calls", calls.Load())
+	}
+
+	_, err = (&http.Client{Transport: player}).Post(elsewhere+"/v1/embeddings", "application/json", strings.NewReader(`{"input":["CS 110"]}`))
+	if !errors.Is(err, ErrFixtureMissing) || !strings.Contains(err.Error(), "POST /v1/embeddings") || !strings.Contains(err.Error(), "CATALOG_FIXTURES=record") {
+		t.Errorf("Expected a missing fixture error naming the request, got %v", err)
+	}
+
+	if _, err := NewFixtureTransport("rewind", dir, nil); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/gocarina/gocsv v0.0.0-20240520201108-78e41c74b4b1
 	github.com/sahilm/fuzzy v0.1.1
 	github.com/sashabaranov/go-openai v1.35.7
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
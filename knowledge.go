@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	"github.com/amikos-tech/chroma-go/types"
+)
+
+const (
+	chunkSize    = 1000 // Target chunk length in characters
+	chunkOverlap = 200  // Trailing text repeated at the start of the next chunk
+	ingestBatch  = 50   // Chunks sent to ChromaDB per request
+)
+
+// OpenDocumentCollection gets the collection holding chunks of university pages, stored
+// next to the course and instructor collections, creating it if needed.
+func OpenDocumentCollection(ctx context.Context, client *chroma.Client, cfg *Config) (*chroma.Collection, error) {
+	openaiEf, err := newEmbeddingFunction(cfg)
+	if err != nil {
+		return nil, &StoreError{Op: "create embedding function", Err: err}
+	}
+	collection, err := client.CreateCollection(ctx, cfg.Chroma.DocumentsCollection, nil, true, openaiEf, types.L2)
+	if err != nil {
+		return nil, &StoreError{Op: "open", Collection: cfg.Chroma.DocumentsCollection, Err: err}
+	}
+	return collection, nil
+}
+
+// IngestDocuments chunks every page under dir (HTML, Markdown, or text extracted from
+// PDFs) and stores the chunks in the documents collection. Chunk IDs are derived from
+// dir and the source path, so ingesting the same directory again replaces earlier chunks;
+// chunks past the end of a page that got shorter, and chunks of pages no longer under
+// dir, are deleted once the new chunks are stored. Chunks ingested from other directories
+// are left alone. It returns the number of chunks stored.
+func IngestDocuments(ctx context.Context, collection *chroma.Collection, dir string) (int, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	root = filepath.ToSlash(root)
+	pages, err := LoadPages(dir, "")
+	if err != nil {
+		return 0, err
+	}
+
+	var ids, documents []string
+	var metadatas []map[string]interface{}
+	chunkCounts := make(map[string]int, len(pages))
+	for _, page := range pages {
+		chunks := chunkText(page.Text, chunkSize, chunkOverlap)
+		chunkCounts[page.Path] = len(chunks)
+		for i, chunk := range chunks {
+			ids = append(ids, root+"/"+filepath.ToSlash(page.Path)+"#"+strconv.Itoa(i))
+			documents = append(documents, chunk)
+			metadatas = append(metadatas, map[string]interface{}{
+				"root":   root,
+				"source": page.Path,
+				"title":  page.Title,
+				"chunk":  i,
+			})
+		}
+	}
+
+	for start := 0; start < len(ids); start += ingestBatch {
+		end := min(start+ingestBatch, len(ids))
+		if _, err := collection.Upsert(ctx, nil, metadatas[start:end], documents[start:end], ids[start:end]); err != nil {
+			return start, fmt.Errorf("failed to store chunks %d-%d: %w", start, end-1, err)
+		}
+		slog.InfoContext(ctx, "Stored document chunks", "stored", end, "of", len(ids))
+	}
+	if err := deleteStaleChunks(ctx, collection, root, chunkCounts); err != nil {
+		return len(ids), err
+	}
+	return len(ids), nil
+}
+
+// deleteStaleChunks deletes the chunks left under root from earlier ingests: those of
+// sources not in chunkCounts, and those numbered past the chunks a source has now.
+func deleteStaleChunks(ctx context.Context, collection *chroma.Collection, root string, chunkCounts map[string]int) error {
+	sources := sortedKeys(chunkCounts)
+	wheres := []map[string]interface{}{{"$and": []map[string]interface{}{
+		{"root": root},
+		{"source": map[string]interface{}{"$nin": sources}},
+	}}}
+	if len(sources) == 0 {
+		wheres[0] = map[string]interface{}{"root": root}
+	}
+	for _, source := range sources {
+		wheres = append(wheres, map[string]interface{}{"$and": []map[string]interface{}{
+			{"root": root},
+			{"source": source},
+			{"chunk": map[string]interface{}{"$gte": chunkCounts[source]}},
+		}})
+	}
+	for _, where := range wheres {
+		deleted, err := collection.Delete(ctx, nil, where, nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete stale chunks: %w", err)
+		}
+		if len(deleted) > 0 {
+			slog.InfoContext(ctx, "Deleted stale document chunks", "deleted", len(deleted))
+		}
+	}
+	return nil
+}
+
+// chunkText splits text into chunks of roughly size characters along paragraph
+// boundaries, repeating up to overlap characters of each chunk at the start of the next.
+func chunkText(text string, size, overlap int) []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.Join(strings.Fields(paragraph), " ")
+		// Break paragraphs that are too long on their own at word boundaries
+		for len(paragraph) > size {
+			cut := strings.LastIndexByte(paragraph[:size], ' ')
+			if cut <= 0 {
+				cut = size
+			}
+			paragraphs = append(paragraphs, paragraph[:cut])
+			paragraph = strings.TrimSpace(paragraph[cut:])
+		}
+		if paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+
+	var chunks []string
+	var current strings.Builder
+	for _, paragraph := range paragraphs {
+		if current.Len() > 0 && current.Len()+len(paragraph)+1 > size {
+			chunk := current.String()
+			chunks = append(chunks, chunk)
+			current.Reset()
+			if tail := overlapTail(chunk, overlap); tail != "" && len(tail)+len(paragraph)+1 <= size {
+				current.WriteString(tail)
+			}
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(paragraph)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// overlapTail returns the last whole words of chunk, at most overlap characters long.
+func overlapTail(chunk string, overlap int) string {
+	if len(chunk) <= overlap {
+		return chunk
+	}
+	tail := chunk[len(chunk)-overlap:]
+	if i := strings.IndexByte(tail, ' '); i >= 0 {
+		tail = tail[i+1:]
+	}
+	return tail
+}
+
+// documentSource returns the source file recorded for a document chunk, or "" for
+// schedule rows.
+func documentSource(doc RetrievedDocument) string {
+	source, _ := doc.Metadata["source"].(string)
+	return source
+}
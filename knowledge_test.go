@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	chroma "github.com/amikos-tech/chroma-go"
+	"github.com/amikos-tech/chroma-go/types"
+)
+
+func TestChunkText(t *testing.T) {
+	paragraph := strings.Repeat("prerequisite ", 30) // 390 characters
+	text := strings.Join([]string{paragraph, paragraph, paragraph}, "\n\n")
+
+	chunks := chunkText(text, 500, 100)
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > 500 {
+			t.Errorf("Chunk %d is %d characters, longer than the chunk size", i, len(chunk))
+		}
+	}
+	if !strings.HasPrefix(chunks[1], "prerequisite") || len(chunks[1]) <= len(strings.TrimSpace(paragraph)) {
+		t.Errorf("Expected chunk 1 to start with overlap from chunk 0, got '%s'", chunks[1])
+	}
+}
+
+func TestMergeDocuments(t *testing.T) {
+	schedule := []RetrievedDocument{{ID: "0", Distance: 0.3}, {ID: "1", Distance: 0.45}}
+	pages := []RetrievedDocument{{ID: "catalog.md#0", Distance: 0.35, Metadata: map[string]interface{}{"source": "catalog.md"}}}
+
+	merged := mergeDocuments(schedule, pages, 2)
+	if len(merged) != 2 || merged[0].ID != "0" || merged[1].ID != "catalog.md#0" {
+		t.Fatalf("Expected the two closest documents in order, got %v", merged)
+	}
+	if documentSource(merged[1]) != "catalog.md" || documentSource(merged[0]) != "" {
+		t.Errorf("Expected only the page chunk to carry a source")
+	}
+}
+
+func TestIngestDocumentsDeletesStaleChunks(t *testing.T) {
+	var upserted []string
+	var deletes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IDs   []string        `json:"ids"`
+			Where json.RawMessage `json:"where"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/upsert"):
+			upserted = append(upserted, body.IDs...)
+			w.Write([]byte("true"))
+		case strings.HasSuffix(r.URL.Path, "/delete"):
+			deletes = append(deletes, string(body.Where))
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client, err := chroma.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := chroma.NewCollection(client.ApiClient, "id", "documents-collection", nil, constantEmbedder{}, types.DefaultTenant, types.DefaultDatabase)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "admissions.md"), []byte("# Admissions\n\nApply by January 15."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	count, err := IngestDocuments(context.Background(), collection, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.ToSlash(dir)
+	if count != 1 || strings.Join(upserted, ",") != root+"/admissions.md#0" {
+		t.Errorf("Expected one chunk to be stored, got %d: %v", count, upserted)
+	}
+	// Pages removed from dir, and chunks past the end of the page, are deleted; chunks
+	// ingested from other directories are not
+	quoted, _ := json.Marshal(root)
+	want := []string{
+		`{"$and":[{"root":` + string(quoted) + `},{"source":{"$nin":["admissions.md"]}}]}`,
+		`{"$and":[{"root":` + string(quoted) + `},{"source":"admissions.md"},{"chunk":{"$gte":1}}]}`,
+	}
+	if strings.Join(deletes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected deletes:\n%s", strings.Join(deletes, "\n"))
+	}
+
+	// Ingesting an empty directory only clears what was ingested from it
+	deletes = nil
+	empty := t.TempDir()
+	if _, err := IngestDocuments(context.Background(), collection, empty); err != nil {
+		t.Fatal(err)
+	}
+	quoted, _ = json.Marshal(filepath.ToSlash(empty))
+	if strings.Join(deletes, "\n") != `{"root":`+string(quoted)+`}` {
+		t.Errorf("Expected only the empty directory's chunks to be deleted, got:\n%s", strings.Join(deletes, "\n"))
+	}
+}
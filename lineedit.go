@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LineEditor reads lines typed at a terminal, with cursor movement, history recall and
+// tab completion. Input that is not a terminal is read line by line without editing.
+type LineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int  // Switched to raw mode while a line is read; -1 for none
+	editing bool // Interpret editing keys
+
+	history     []string
+	historyFile string // Lines are appended here as they are entered; empty keeps them in memory
+	historySize int    // Lines kept; zero keeps all
+
+	// Complete returns completions for the text before the cursor: where the fragment
+	// being completed starts, and the candidates replacing it.
+	Complete func(line []rune) (int, []string)
+}
+
+// NewLineEditor reads lines from in, editing them if in is a terminal.
+func NewLineEditor(in *os.File, out io.Writer) *LineEditor {
+	restore, err := enableRawMode(int(in.Fd()))
+	if err != nil {
+		return newLineEditor(in, out, false)
+	}
+	restore()
+	editor := newLineEditor(in, out, true)
+	editor.fd = int(in.Fd())
+	return editor
+}
+
+func newLineEditor(in io.Reader, out io.Writer, editing bool) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(in), out: out, fd: -1, editing: editing}
+}
+
+// Editing reports whether lines are edited at a terminal.
+func (e *LineEditor) Editing() bool {
+	return e.editing
+}
+
+// LoadHistory reads the lines entered in earlier sessions from path, keeps the last
+// size of them, and appends the lines entered from now on to it. A missing file starts
+// an empty history.
+func (e *LineEditor) LoadHistory(path string, size int) error {
+	e.historyFile, e.historySize = path, size
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read history: %w", err)
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	e.history = strings.Split(text, "\n")
+	if size > 0 && len(e.history) > size {
+		// Rewrite the file so it does not grow without bound
+		e.history = e.history[len(e.history)-size:]
+		if err := os.WriteFile(path, []byte(strings.Join(e.history, "\n")+"\n"), 0o600); err != nil {
+			return fmt.Errorf("Failed to trim history: %w", err)
+		}
+	}
+	return nil
+}
+
+// History returns the lines entered, oldest first.
+func (e *LineEditor) History() []string {
+	return slices.Clone(e.history)
+}
+
+// addHistory records an entered line without surrounding spaces, skipping blank lines
+// and repeats of the previous line.
+func (e *LineEditor) addHistory(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.historySize > 0 && len(e.history) > e.historySize {
+		e.history = e.history[len(e.history)-e.historySize:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.historyFile), 0o755); err != nil {
+		slog.Warn("Failed to save history", "err", err)
+		return
+	}
+	file, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Warn("Failed to save history", "err", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.WriteString(line + "\n"); err != nil {
+		slog.Warn("Failed to save history", "err", err)
+	}
+}
+
+// ReadLine shows prompt and returns the next line without its newline. It returns
+// io.EOF at the end of input, or when Ctrl-D is pressed on an empty line.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if !e.editing {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		e.addHistory(line)
+		return line, nil
+	}
+	if e.fd >= 0 {
+		restore, err := enableRawMode(e.fd)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read from the terminal: %w", err)
+		}
+		defer restore()
+	}
+	return e.editLine(prompt)
+}
+
+// Keys interpreted while editing.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+	keyDelete    = -1 // Delete the character under the cursor; never ends input like Ctrl-D
+	keyUnknown   = -2
+)
+
+// maxListedCompletions limits the candidates listed when Tab cannot complete further.
+const maxListedCompletions = 40
+
+// editLine reads keys until Enter, redrawing the line as it is edited.
+func (e *LineEditor) editLine(prompt string) (string, error) {
+	var line []rune
+	pos := 0
+	recalled := len(e.history) // History entry shown; len(e.history) is the line being typed
+	draft := ""                // The line being typed, kept while history is shown
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+
+	redraw()
+	for {
+		key, _, err := e.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(e.out, "\n")
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				e.addHistory(string(line))
+				return string(line), nil
+			}
+			return "", err
+		}
+		if key == keyEscape {
+			key = e.escapeSequence()
+		}
+
+		switch key {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\n")
+			e.addHistory(string(line))
+			return string(line), nil
+		case keyCtrlC:
+			// Abandon the line, as shells do
+			fmt.Fprint(e.out, "^C\n")
+			line, pos, recalled = nil, 0, len(e.history)
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+			fallthrough
+		case keyDelete:
+			if pos < len(line) {
+				line = slices.Delete(line, pos, pos+1)
+			}
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				line = slices.Delete(line, pos-1, pos)
+				pos--
+			}
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(line)
+		case keyCtrlB:
+			pos = max(pos-1, 0)
+		case keyCtrlF:
+			pos = min(pos+1, len(line))
+		case keyCtrlK:
+			line = line[:pos]
+		case keyCtrlU:
+			line = slices.Delete(line, 0, pos)
+			pos = 0
+		case keyCtrlW:
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = slices.Delete(line, start, pos)
+			pos = start
+		case keyCtrlP, keyCtrlN:
+			next := recalled - 1
+			if key == keyCtrlN {
+				next = recalled + 1
+			}
+			if next < 0 || next > len(e.history) {
+				break
+			}
+			if recalled == len(e.history) {
+				draft = string(line)
+			}
+			recalled = next
+			text := draft
+			if recalled < len(e.history) {
+				text = e.history[recalled]
+			}
+			line = []rune(text)
+			pos = len(line)
+		case keyTab:
+			line, pos = e.complete(line, pos)
+		default:
+			if key >= 0 && unicode.IsPrint(key) {
+				line = slices.Insert(line, pos, key)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
+
+// escapeSequence reads the rest of an escape sequence and returns the key it stands for.
+func (e *LineEditor) escapeSequence() rune {
+	next, _, err := e.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return keyUnknown
+	}
+	code, _, err := e.in.ReadRune()
+	if err != nil {
+		return keyUnknown
+	}
+	// Sequences such as ESC [ 3 ~ end with a tilde after the number
+	if code >= '0' && code <= '9' {
+		if end, _, err := e.in.ReadRune(); err != nil || end != '~' {
+			return keyUnknown
+		}
+	}
+	switch code {
+	case 'A':
+		return keyCtrlP
+	case 'B':
+		return keyCtrlN
+	case 'C':
+		return keyCtrlF
+	case 'D':
+		return keyCtrlB
+	case 'H', '1', '7':
+		return keyCtrlA
+	case 'F', '4', '8':
+		return keyCtrlE
+	case '3':
+		return keyDelete
+	}
+	return keyUnknown
+}
+
+// complete completes the text before the cursor: with the only candidate, or as far as
+// all candidates agree. If that adds nothing, the candidates are listed instead.
+func (e *LineEditor) complete(line []rune, pos int) ([]rune, int) {
+	if e.Complete == nil {
+		return line, pos
+	}
+	start, candidates := e.Complete(line[:pos])
+	if len(candidates) == 0 {
+		return line, pos
+	}
+	replacement := candidates[0] + " "
+	if len(candidates) > 1 {
+		replacement = commonPrefix(candidates)
+		if utf8.RuneCountInString(replacement) <= pos-start {
+			listed := candidates[:min(len(candidates), maxListedCompletions)]
+			more := ""
+			if len(candidates) > len(listed) {
+				more = fmt.Sprintf("  (%d more)", len(candidates)-len(listed))
+			}
+			fmt.Fprintf(e.out, "\n%s%s\n", strings.Join(listed, "  "), more)
+			return line, pos
+		}
+	}
+	completed := []rune(replacement)
+	return slices.Concat(line[:start], completed, line[pos:]), start + len(completed)
+}
+
+// commonPrefix returns the longest prefix the words share, ignoring case, as spelled in
+// the first word.
+func commonPrefix(words []string) string {
+	prefix := []rune(words[0])
+	for _, word := range words[1:] {
+		n := 0
+		for _, r := range word {
+			if n == len(prefix) || unicode.ToLower(r) != unicode.ToLower(prefix[n]) {
+				break
+			}
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineEditing(t *testing.T) {
+	const (
+		left  = "\x1b[D"
+		up    = "\x1b[A"
+		down  = "\x1b[B"
+		home  = "\x1b[H"
+		del   = "\x1b[3~"
+		ctrlA = "\x01"
+		ctrlC = "\x03"
+		ctrlE = "\x05"
+		ctrlK = "\x0b"
+		ctrlU = "\x15"
+		ctrlW = "\x17"
+	)
+	keys := strings.Join([]string{
+		"who teaches CS 11" + left + left + "2" + del + "\r", // "who teaches CS 21"
+		"room HR 148" + ctrlA + "free" + ctrlW + "x " + ctrlE + "!\r",
+		"forgotten" + ctrlC + "kept\x7f\x7fpt\r",
+		"abc" + home + ctrlK + "def" + ctrlU + "ghi\r",
+		up + up + up + down + "\r",   // Up to "x room HR 148!", then down to "kept"
+		up + down + down + "draft\r", // Down past the line being typed stays on it
+		"\x04",
+	}, "")
+	editor := newLineEditor(strings.NewReader(keys), io.Discard, true)
+
+	want := []string{"who teaches CS 21", "x room HR 148!", "kept", "ghi", "kept", "draft"}
+	for i, expected := range want {
+		line, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Fatalf("Line %d: %v", i+1, err)
+		}
+		if line != expected {
+			t.Errorf("Line %d: expected %q, got %q", i+1, expected, line)
+		}
+	}
+	if _, err := editor.ReadLine("> "); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected Ctrl-D on an empty line to end input, got %v", err)
+	}
+	if history := strings.Join(editor.History(), "|"); history != "who teaches CS 21|x room HR 148!|kept|ghi|kept|draft" {
+		t.Errorf("Unexpected history %q", history)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "history")
+	editor := newLineEditor(strings.NewReader("one\ntwo\n\ntwo\nthree\nfour"), io.Discard, false)
+	if err := editor.LoadHistory(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := editor.ReadLine("> "); err != nil {
+			break
+		}
+	}
+
+	// The next session recalls the last lines, and the file is trimmed to match
+	next := newLineEditor(strings.NewReader("\x1b[A\x1b[A\r"), io.Discard, true)
+	if err := next.LoadHistory(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if history := strings.Join(next.History(), "|"); history != "two|three|four" {
+		t.Errorf("Expected the last three lines, got %q", history)
+	}
+	if line, _ := next.ReadLine("> "); line != "three" {
+		t.Errorf("Expected to recall the line before last, got %q", line)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "two\nthree\nfour\nthree\n" {
+		t.Errorf("Unexpected history file %q", data)
+	}
+}
+
+func TestTabCompletion(t *testing.T) {
+	metadata := &MetadataExtractor{
+		Departments: []string{"CS", "CHEM"},
+		Instructors: []string{"Julia Nolfo", "Julian Smith"},
+		courses:     []Course{{CRN: "40630"}, {CRN: "40631"}},
+	}
+	var out strings.Builder
+	keys := "who Julia N\t\r" + "/hi\t\r" + "/courses jul\t\r" + "crn 4063\t1\r" + "C\t\r"
+	editor := newLineEditor(strings.NewReader(keys), &out, true)
+	editor.Complete = scheduleCompleter(metadata)
+
+	want := []string{"who Julia Nolfo", "/history", "/courses Julia", "crn 40631", "C"}
+	for i, expected := range want {
+		line, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(line) != expected {
+			t.Errorf("Line %d: expected %q, got %q", i+1, expected, line)
+		}
+	}
+	// Tab on an ambiguous fragment lists what it could be
+	if !strings.Contains(out.String(), "\nCHEM  CS\n") {
+		t.Errorf("Expected the candidates for C to be listed, got %q", out.String())
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
     "context"
     "fmt"
+    "time"
 
     openai "github.com/sashabaranov/go-openai"
 )
@@ -10,6 +11,7 @@ import (
 // LLMClient wraps the OpenAI client for interaction with an LLM (Large Language Model).
 type LLMClient struct {
     client *openai.Client // OpenAI client for API communication.
+    model  string         // Chat model used for completions.
 }
 
 // NewLLMClient initializes a new LLMClient with the provided OpenAI API key.
@@ -18,21 +20,35 @@ type LLMClient struct {
 // Returns:
 // - A pointer to an LLMClient instance.
 func NewLLMClient(apiKey string) *LLMClient {
-    client := openai.NewClient(apiKey) // Create a new OpenAI client using the API key.
-    return &LLMClient{client: client} // Wrap the OpenAI client in an LLMClient instance.
+    config := openai.DefaultConfig(apiKey)
+    config.HTTPClient = newHTTPClient() // Requests go through httpTransport so they can be recorded or replayed.
+    client := openai.NewClientWithConfig(config)
+    return &LLMClient{client: client, model: openai.GPT4oMini} // Wrap the OpenAI client in an LLMClient instance.
+}
+
+// SetModel changes the chat model used for completions.
+func (llm *LLMClient) SetModel(model string) {
+    llm.model = model
 }
 
 // ChatCompletion sends a user's query to the LLM and retrieves a response.
 // Parameters:
+// - ctx: Cancels the request or limits how long it may take.
 // - question: The user's input question or query.
 // - systemMessage: A system-level instruction to guide the LLM's behavior.
 // Returns:
 // - A string containing the LLM's response.
 // - An error if the API call or response processing fails.
-func (llm *LLMClient) ChatCompletion(question, systemMessage string) (string, error) {
+func (llm *LLMClient) ChatCompletion(ctx context.Context, question, systemMessage string) (string, error) {
+    // Over budget, use a cheaper model or make no call at all, as answers do.
+    model, err := usageModel(ctx, llm.model)
+    if err != nil {
+        return "", err
+    }
+
     // Create a chat completion request with the given system message and user query.
     req := openai.ChatCompletionRequest{
-        Model: openai.GPT4oMini, // Specify the model to use for the completion.
+        Model: model, // Specify the model to use for the completion.
         Messages: []openai.ChatCompletionMessage{
             {
                 Role:    openai.ChatMessageRoleSystem, // System-level instruction to set context.
@@ -46,12 +62,18 @@ func (llm *LLMClient) ChatCompletion(question, systemMessage string) (string, er
     }
 
     // Call the OpenAI API to generate a chat completion.
-    resp, err := llm.client.CreateChatCompletion(context.Background(), req)
+    started := time.Now()
+    resp, err := llm.client.CreateChatCompletion(ctx, req)
+    metrics.stageSeconds.Observe(time.Since(started).Seconds(), stageCompletion)
     if err != nil {
         // Return an error if the API call fails.
+        metrics.recordLLMError(err)
         return "", fmt.Errorf("CreateChatCompletion failed: %w", err)
     }
 
+    // One-shot completions interpret queries, so their usage counts as query parsing.
+    recordCompletionUsage(withUsageFeature(ctx, featureQueryParsing), model, resp.Usage)
+
     // Extract and return the content of the LLM's response message.
     return resp.Choices[0].Message.Content, nil
 }
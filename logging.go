@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging installs the configured structured logger as the default for slog and
+// the log package. Interactive sessions only show warnings unless a level is
+// configured, so logs don't interleave with answers.
+func setupLogging(cfg LogConfig, interactive bool) error {
+	level := slog.LevelInfo
+	if interactive {
+		level = slog.LevelWarn
+	}
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return fmt.Errorf("log.level: %w", err)
+		}
+	}
+
+	var w io.Writer = os.Stderr
+	if cfg.File != "" {
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("Failed to open log file: %w", err)
+		}
+		w = file
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, logFormatJSON) {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	slog.SetDefault(slog.New(requestHandler{handler}))
+	return nil
+}
+
+// Log formats.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// requestHandler adds the request ID of the context to every record logged with one.
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
+
+// requestIDKey carries the ID of the question being answered in a context.
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose logs and trace carry id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, or "" if it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ensureRequestID gives ctx a new request ID unless it already has one.
+func ensureRequestID(ctx context.Context) context.Context {
+	if RequestID(ctx) != "" {
+		return ctx
+	}
+	return WithRequestID(ctx, newRequestID())
+}
+
+// newRequestID returns a random 128-bit ID, which also serves as the trace ID.
+func newRequestID() string {
+	return randomHex(16)
+}
+
+// randomHex returns n random bytes in hex. The bytes name sessions, which only their
+// IDs keep apart, so it panics rather than return predictable IDs if the system's
+// random source fails.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("Failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
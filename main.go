@@ -1,82 +1,137 @@
 package main
 
 import (
-    "bufio" 
+    "context"
+    "errors"
+    "flag"
     "fmt" 
-    "log" 
+    "io"
+    "log/slog"
     "os" 
+    "strings"
 )
 
-// Declare a global variable for the chatbot instance.
-var chatbot *ChatBot
-
 func main() {
-    // Retrieve the OpenAI API key from an environment variable.
-    apiKey := os.Getenv("OPENAI_PROJECT_KEY")
-    if apiKey == "" {
-        log.Fatal("API key is missing. Please set OPENAI_PROJECT_KEY environment variable.")
+    // Dispatch to the subcommand named on the command line (chat by default).
+    if err := run(os.Args[1:], os.Stdout); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            return
+        }
+        // Logs may be filtered or sent to a file, so errors go straight to the terminal.
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
     }
+}
 
-    // Path to the CSV file containing course information.
-    csvFilePath := "Fall 2024 Class Schedule 08082024.csv"
-
-    // Initialize the LLM client using the API key.
-    llmClient := NewLLMClient(apiKey)
+// runInteractiveMode starts an interactive loop to process user queries. Lines are
+// edited and completed when standard input is a terminal, and tables are rendered in
+// the given style. With debug, each answer is followed by a trace of how it was found.
+func runInteractiveMode(chatbot *ChatBot, cfg REPLConfig, style TableStyle, debug bool) {
+    // Read lines from the terminal, recalling those entered in earlier sessions. Lines
+    // piped in by scripts are not kept.
+    editor := NewLineEditor(os.Stdin, os.Stdout)
+    if cfg.HistoryFile != "" && editor.Editing() {
+        if err := editor.LoadHistory(cfg.HistoryFile, cfg.HistorySize); err != nil {
+            slog.Warn("Starting without history", "err", err)
+        }
+    }
+    editor.Complete = scheduleCompleter(chatbot.metadata)
+    r := &repl{chatbot: chatbot, editor: editor, out: os.Stdout, style: style, debug: debug}
 
-    // Initialize the metadata extractor using the CSV file and the LLM client.
-    metadataExtractor, err := NewMetadataExtractor(csvFilePath, llmClient)
-    if err != nil {
-        log.Fatalf("Failed to initialize MetadataExtractor: %v", err) // Log the error and exit.
+    // Tell the user up front if answers come from the in-process data instead of the vector store.
+    degraded := chatbot.Degraded()
+    if degraded != nil {
+        fmt.Println(storeNotice(nil, degraded))
     }
+    fmt.Println("Type /help for commands.")
 
-    // Add course and instructor data to ChromaDB collections.
-    chromaCtx, chromaClient, courseCollection, instructorCollection := Add(metadataExtractor.courses)
+    // Loop to continuously read and process user input.
+    for {
+        // Prompt the user for the next query.
+        fmt.Println()
+        question, err := editor.ReadLine("Catalog search> ")
+        if err != nil {
+            // Handle any errors encountered while reading input; the end of input just ends the chat.
+            if !errors.Is(err, io.EOF) {
+                slog.Error("Failed to read input", "err", err)
+            }
+            return
+        }
+        if strings.TrimSpace(question) == "" {
+            // If the input is empty, prompt the user to enter a valid query.
+            fmt.Println("Please enter a valid query.")
+            continue
+        }
 
-    // Initialize the chatbot with the required components: LLM client,  Metadata extractor ,ChromaDB context and 
-    // collections for courses and instructors.
-    chatbot = NewChatBot(llmClient, metadataExtractor, chromaCtx, chromaClient, courseCollection, instructorCollection)
+        // Slash commands such as /reset and /stats control the chat itself.
+        if strings.HasPrefix(strings.TrimSpace(question), "/") {
+            if r.command(question) {
+                return
+            }
+            continue
+        }
 
-    // Notify the user that data has been added to collections and start the chatbot.
-    fmt.Println("Courses and instructors added to collections.")
-    fmt.Println("Entering interactive mode. Type your questions below:")
-    runInteractiveMode() // Start interactive user input handling.
-}
+        // "who <name>" prints an instructor's profile; anything else goes to the chatbot.
+        if name, ok := cutCommand(question, "who"); ok {
+            if profile, found := chatbot.InstructorProfile(name); found {
+                fmt.Println(profile.Document())
+                continue
+            }
+        }
 
-// runInteractiveMode starts an interactive loop to process user queries.
-func runInteractiveMode() {
-    // Initialize a scanner to read input from the standard input (terminal).
-    scanner := bufio.NewScanner(os.Stdin)
+        // Use the chatbot to process the user's question. Ctrl-C cancels just this question.
+        ctx, stop := interruptContext()
+        var details *AnswerDetails
+        if r.debug {
+            ctx, details = WithAnswerDetails(ctx)
+        }
+        answer, err := chatbot.AnswerQuestionStructured(ctx, question)
+        stop()
 
-    // Print the initial prompt for the user.
-    fmt.Print("\nCatalog search> ")
+        // Report the vector store going down or coming back during the session.
+        if notice := storeNotice(degraded, chatbot.Degraded()); notice != "" {
+            fmt.Println(notice)
+        }
+        degraded = chatbot.Degraded()
 
-    // Loop to continuously read and process user input.
-    for scanner.Scan() {
-        // Read the user's query from input.
-        question := scanner.Text()
-        if question == "" {
-            // If the input is empty, prompt the user to enter a valid query.
-            fmt.Println("Please enter a valid query.")
-            fmt.Print("\nCatalog search> ")
+        if errors.Is(err, context.Canceled) {
+            fmt.Println("Question cancelled.")
             continue
         }
-
-        // Use the chatbot to process the user's question.
-        answer, err := chatbot.AnswerQuestion(question)
         if err != nil {
             // Handle errors during question processing.
             fmt.Printf("Error processing your question: %v\n", err)
-            fmt.Print("\nCatalog search> ")
             continue
         }
 
-        // Print the chatbot's response to the user's question.
-        fmt.Println("ChatBot:", answer)
-        fmt.Print("\nCatalog search> ") // Prompt the user for the next query.
+        // Print the chatbot's response to the user's question, with any suggested follow-ups.
+        r.last = answer
+        fmt.Print("ChatBot: ")
+        writeAnswer(os.Stdout, answer, style)
+        if details != nil {
+            writeDebug(os.Stdout, details)
+        }
     }
+}
+
+// cutCommand reports whether input starts with the given command word and returns the
+// rest of the line.
+func cutCommand(input, command string) (string, bool) {
+    fields := strings.Fields(input)
+    if len(fields) == 0 || !strings.EqualFold(fields[0], command) {
+        return "", false
+    }
+    return strings.TrimSpace(strings.TrimSpace(input)[len(fields[0]):]), true
+}
 
-    // Handle any errors encountered while reading input.
-    if err := scanner.Err(); err != nil {
-        log.Println("Error reading input:", err)
+// storeNotice describes a change in the vector store's state between two questions, or
+// returns "" if nothing changed.
+func storeNotice(previous, current error) string {
+    switch {
+    case previous == nil && current != nil:
+        return fmt.Sprintf("Note: the vector store is unavailable (%v). Answers use the in-process course data until it recovers.", current)
+    case previous != nil && current == nil:
+        return "Note: the vector store is available again."
     }
+    return ""
 }
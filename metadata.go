@@ -4,8 +4,9 @@ import (
     "fmt"
     "os"
     "bufio"
+    "io"
     "strings"
-    "log"
+    "log/slog"
 
     "github.com/sahilm/fuzzy"
 )
@@ -18,6 +19,16 @@ type MetadataExtractor struct {
     header 		string
 }
 
+// CourseByCRN returns the section with the given CRN.
+func (m *MetadataExtractor) CourseByCRN(crn string) (Course, bool) {
+    for _, course := range m.courses {
+        if course.CRN == crn {
+            return course, true
+        }
+    }
+    return Course{}, false
+}
+
 // Instructor represents an instructor with a canonical name and aliases
 type Instructor struct {
     CanonicalName string
@@ -34,14 +45,14 @@ func NewMetadataExtractor(csvFilePath string, client *LLMClient) (*MetadataExtra
     defer file.Close()
 
     // Read the first line to capture the header row
-    scanner := bufio.NewScanner(file)
-    if !scanner.Scan() {
-        return nil, fmt.Errorf("Error reading header row: %w", scanner.Err())
+    reader := bufio.NewReader(file)
+    header, err := reader.ReadString('\n')
+    if err != nil && header == "" {
+        return nil, fmt.Errorf("Error reading header row: %w", err)
     }
-    header := scanner.Text()
 
-    // Read the rest of the CSV data into course records.
-    courses, err := ReadCSV(file)
+    // Read the CSV data into course records, handing the header back to the parser.
+    courses, err := ReadCSV(io.MultiReader(strings.NewReader(header), reader))
     if err != nil {
         return nil, fmt.Errorf("Error reading CSV: %w", err)
     }
@@ -53,7 +64,7 @@ func NewMetadataExtractor(csvFilePath string, client *LLMClient) (*MetadataExtra
         Instructors: instructors,
         Departments: departments,
         courses:     courses,
-        header:      header,
+        header:      strings.TrimRight(header, "\r\n"),
     }, nil
 }
 
@@ -87,14 +98,14 @@ func findCanonicalName(inputName string, instructors []Instructor) string {
     // Perform fuzzy matching
     matches := fuzzy.Find(inputName, allAliases)
     if len(matches) == 0 {
-        log.Printf("No match found for '%s'.", inputName)
+        slog.Debug("No instructor matches name", "name", inputName)
         return ""
     }
 
     // Return the canonical name for the best match
     bestMatch := matches[0].Str
     canonicalName := aliasToCanonical[bestMatch]
-    log.Printf("Best match for '%s' is '%s', mapped to canonical name '%s'.", inputName, bestMatch, canonicalName)
+    slog.Debug("Matched instructor name", "name", inputName, "alias", bestMatch, "instructor", canonicalName)
     return canonicalName
 }
 // func findCanonicalName(inputName string, instructors []Instructor) string {
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// metrics records how the assistant behaves for the /metrics endpoint of serve mode.
+// Like the embedding cache registry it is process-wide, so code without a ChatBot,
+// such as loading the vector store, records into it as well.
+var metrics = newMetricSet()
+
+// metricSet holds every metric the assistant records.
+type metricSet struct {
+	questions        *counterVec
+	stageSeconds     *histogramVec
+	retrievals       *counterVec
+	retrievalHits    *counterVec
+	emptyRetrievals  *counterVec
+	llmErrors        *counterVec
+	storeAddRetries  *counterVec
+	storeAddFailures *counterVec
+}
+
+// latencyBuckets are the upper bounds, in seconds, of the stage latency histograms.
+// Completions can take tens of seconds, so the buckets reach a minute.
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+func newMetricSet() *metricSet {
+	return &metricSet{
+		questions:        newCounterVec("catalog_questions_total", "Questions handled, by outcome: answered, failed or cancelled.", "outcome"),
+		stageSeconds:     newHistogramVec("catalog_stage_duration_seconds", "Time taken by each stage of answering a question.", latencyBuckets, "stage"),
+		retrievals:       newCounterVec("catalog_retrievals_total", "Retrievals for questions, by source: vector store or in-process fallback.", "source"),
+		retrievalHits:    newCounterVec("catalog_retrieval_hits_total", "Relevant documents retrieved for questions, by source.", "source"),
+		emptyRetrievals:  newCounterVec("catalog_empty_retrievals_total", "Retrievals that found no relevant documents, by source.", "source"),
+		llmErrors:        newCounterVec("catalog_llm_errors_total", "Failed chat completions, by type of error.", "type"),
+		storeAddRetries:  newCounterVec("catalog_store_add_retries_total", "Vector store adds retried after a failed attempt."),
+		storeAddFailures: newCounterVec("catalog_store_add_failures_total", "Vector store adds that failed after every retry."),
+	}
+}
+
+// Stages timed by catalog_stage_duration_seconds.
+const (
+	stageAnswer     = "answer"
+	stageRetrieval  = "retrieval"
+	stageCompletion = "completion"
+	stageWebSearch  = "web_search"
+)
+
+// Retrieval sources.
+const (
+	sourceVector = "vector"
+	sourceLocal  = "local"
+)
+
+// recordRetrieval counts a retrieval and how many relevant documents it found.
+func (m *metricSet) recordRetrieval(source string, relevant int) {
+	m.retrievals.Add(1, source)
+	m.retrievalHits.Add(float64(relevant), source)
+	if relevant == 0 {
+		m.emptyRetrievals.Add(1, source)
+	}
+}
+
+// questionOutcome labels a handled question for catalog_questions_total.
+func questionOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "answered"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+// recordLLMError counts a failed completion by its type.
+func (m *metricSet) recordLLMError(err error) {
+	m.llmErrors.Add(1, llmErrorType(err))
+}
+
+// llmErrorType classifies a chat completion error for catalog_llm_errors_total.
+func llmErrorType(err error) string {
+	var apiErr *openai.APIError
+	var requestErr *openai.RequestError
+	status := 0
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &requestErr):
+		status = requestErr.HTTPStatusCode
+	default:
+		return "network"
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "auth"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit"
+	case status >= 500:
+		return "server"
+	default:
+		return "request"
+	}
+}
+
+// write writes every metric in the Prometheus text format.
+func (m *metricSet) write(w io.Writer) {
+	m.questions.write(w)
+	m.stageSeconds.write(w)
+	m.retrievals.write(w)
+	m.retrievalHits.write(w)
+	m.emptyRetrievals.write(w)
+	m.llmErrors.write(w)
+	m.storeAddRetries.write(w)
+	m.storeAddFailures.write(w)
+}
+
+// counterVec is a counter with one series per combination of label values.
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]float64 // Keyed by labelKey
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, series: make(map[string]float64)}
+}
+
+// Add adds delta to the series with the given label values.
+func (c *counterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[labelKey(labelValues)] += delta
+}
+
+// Value returns the count of the series with the given label values.
+func (c *counterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.series[labelKey(labelValues)]
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	if len(c.labels) == 0 {
+		// Unlabelled counters are always exposed, even before the first increment
+		fmt.Fprintf(w, "%s %s\n", c.name, formatValue(c.series[""]))
+		return
+	}
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, splitLabelKey(key)), formatValue(c.series[key]))
+	}
+}
+
+// histogramVec is a histogram with one series per combination of label values.
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+// histogram counts observations per bucket; counts are not cumulative until written.
+type histogram struct {
+	counts []uint64 // One per bucket, then one for +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+// Observe records a value in the series with the given label values.
+func (h *histogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := labelKey(labelValues)
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = series
+	}
+	series.counts[sort.SearchFloat64s(h.buckets, value)]++
+	series.sum += value
+	series.count++
+}
+
+// Count returns how many values the series with the given label values has recorded.
+func (h *histogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if series, ok := h.series[labelKey(labelValues)]; ok {
+		return series.count
+	}
+	return 0
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		values := splitLabelKey(key)
+		labels := append(h.labels[:len(h.labels):len(h.labels)], "le")
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(values, formatValue(bound))), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(values, "+Inf")), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), series.count)
+	}
+}
+
+// writeMetric writes a single unlabelled value of the given type, such as a reading
+// taken from cache stats when scraped.
+func writeMetric(w io.Writer, name, help, kind string, value float64) {
+	writeHeader(w, name, help, kind)
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelKey joins label values into a map key. The separator cannot appear in values
+// written by this package.
+func labelKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+func splitLabelKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, "\x00")
+}
+
+// formatLabels renders {name="value",...}, or "" without labels.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	chatbot := NewChatBot(echoLLM(t, nil), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetAnswerCache(NewAnswerCache(DefaultConfig().Answers))
+	handler := newServer(NewSessionManager(chatbot, time.Hour))
+
+	answered := metrics.questions.Value("answered")
+	empty := metrics.emptyRetrievals.Value(sourceLocal)
+	completions := metrics.stageSeconds.Count(stageCompletion)
+	for _, question := range []string{"Who teaches CS 110?", "who teaches cs 110", "Who teaches ASTRO 999?"} {
+		if recorder := postQuestion(handler, fmt.Sprintf(`{"question": %q}`, question), ""); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected %q to be answered, got %d", question, recorder.Code)
+		}
+	}
+	if got := metrics.questions.Value("answered") - answered; got != 3 {
+		t.Errorf("Expected 3 more answered questions, got %v", got)
+	}
+	if got := metrics.emptyRetrievals.Value(sourceLocal) - empty; got != 1 {
+		t.Errorf("Expected 1 more empty retrieval, got %v", got)
+	}
+	if got := metrics.stageSeconds.Count(stageCompletion) - completions; got != 1 {
+		t.Errorf("Expected one completion, the rest cached or unanswerable, got %d", got)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE catalog_questions_total counter\n",
+		`catalog_questions_total{outcome="answered"} `,
+		"# TYPE catalog_stage_duration_seconds histogram\n",
+		`catalog_stage_duration_seconds_bucket{stage="retrieval",le="+Inf"} `,
+		`catalog_stage_duration_seconds_count{stage="completion"} `,
+		`catalog_retrieval_hits_total{source="local"} `,
+		"catalog_store_add_retries_total ",
+		"catalog_answer_cache_hits_total 1\n",
+		"catalog_sessions 3\n",
+		"catalog_degraded 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in /metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestLLMErrorMetrics(t *testing.T) {
+	llm := newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"message": "Rate limit reached", "type": "requests"}}`))
+	})
+	before := metrics.llmErrors.Value("rate_limit")
+	if _, err := llm.ChatCompletion(context.Background(), "Who teaches CS 110?", "Answer briefly."); err == nil {
+		t.Fatal("Expected the completion to fail")
+	}
+	if got := metrics.llmErrors.Value("rate_limit") - before; got != 1 {
+		t.Errorf("Expected one rate limit error, got %v", got)
+	}
+
+	for err, want := range map[error]string{
+		context.DeadlineExceeded:                                         "timeout",
+		&openai.APIError{HTTPStatusCode: http.StatusUnauthorized}:        "auth",
+		&openai.RequestError{HTTPStatusCode: http.StatusBadGateway}:      "server",
+		fmt.Errorf("wrapped: %w", &openai.APIError{HTTPStatusCode: 400}): "request",
+		errors.New("connection refused"):                                 "network",
+	} {
+		if got := llmErrorType(err); got != want {
+			t.Errorf("llmErrorType(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
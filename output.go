@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats accepted by the --format flag.
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatTable = "table"
+	formatCSV   = "csv"
+)
+
+// validFormat reports whether format is one of the supported output formats.
+func validFormat(format string) bool {
+	return format == formatText || format == formatJSON || format == formatTable || format == formatCSV
+}
+
+// writeJSON writes value as indented JSON.
+func writeJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// courseTimes renders a section's days and times, e.g. "TR 1:30 PM-3:10 PM".
+func courseTimes(course Course) string {
+	start, okStart := parseClock(course.BeginTime)
+	end, okEnd := parseClock(course.EndTime)
+	if !okStart || !okEnd {
+		return strings.TrimSpace(course.MeetDays)
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s-%s", course.MeetDays, formatClock(start), formatClock(end)))
+}
+
+// writeCourses writes schedule rows in the given format. Tables are fitted and
+// highlighted as style asks.
+func writeCourses(w io.Writer, courses []Course, format string, style TableStyle) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, courses)
+	case formatTable:
+		return writeCourseTable(w, courses, style)
+	case formatCSV:
+		return writeCourseCSV(w, courses)
+	default:
+		for _, course := range courses {
+			fmt.Fprintf(w, "%s %s-%s %s, %s, %s %s, %s (CRN %s)\n", course.Subject, course.CourseNumber, course.Section,
+				course.Title, courseTimes(course), course.Building, course.Room, instructorName(course), course.CRN)
+		}
+		return nil
+	}
+}
+
+// writeProfiles writes instructor profiles in the given format.
+func writeProfiles(w io.Writer, profiles []InstructorProfile, format string) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, profiles)
+	case formatTable:
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "NAME\tEMAIL\tDEPARTMENTS\tSECTIONS\tENROLLMENT")
+		for _, profile := range profiles {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\n", profile.Name, profile.Email,
+				strings.Join(profile.Departments, ","), len(profile.Courses), profile.TotalEnrollment)
+		}
+		return table.Flush()
+	case formatCSV:
+		out := csv.NewWriter(w)
+		out.Write([]string{"Name", "Email", "Departments", "Sections", "Enrollment"})
+		for _, profile := range profiles {
+			out.Write([]string{profile.Name, profile.Email, strings.Join(profile.Departments, ","),
+				strconv.Itoa(len(profile.Courses)), strconv.Itoa(profile.TotalEnrollment)})
+		}
+		out.Flush()
+		return out.Error()
+	default:
+		for _, profile := range profiles {
+			fmt.Fprintf(w, "%s <%s> %s, %d sections\n", profile.Name, profile.Email,
+				strings.Join(profile.Departments, ","), len(profile.Courses))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Page is a university web page or document stored on disk.
+type Page struct {
+	Path  string // Path of the file relative to the directory it was loaded from
+	URL   string // Public URL of the page, empty if unknown
+	Title string
+	Text  string // Plain text content with markup removed
+}
+
+var (
+	scriptPattern    = regexp.MustCompile(`(?is)<(script|style|noscript)[^>]*>.*?</(script|style|noscript)>`)
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	canonicalPattern = regexp.MustCompile(`(?is)<link[^>]+rel=["']canonical["'][^>]*href=["']([^"']+)["']`)
+	ogURLPattern     = regexp.MustCompile(`(?is)<meta[^>]+property=["']og:url["'][^>]*content=["']([^"']+)["']`)
+	blockTagPattern  = regexp.MustCompile(`(?i)</?(p|div|br|li|tr|h[1-6]|section|article|table)[^>]*>`)
+	tagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacePattern     = regexp.MustCompile(`[ \t]+`)
+	blankLinePattern = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// pageExtensions lists the file types LoadPages understands.
+var pageExtensions = map[string]bool{".html": true, ".htm": true, ".md": true, ".txt": true}
+
+// LoadPages reads every HTML, Markdown and plain-text file under dir.
+// Page URLs come from a canonical link or og:url tag in HTML, a "url:" line in
+// Markdown front matter, or baseURL joined with the file's relative path.
+func LoadPages(dir, baseURL string) ([]Page, error) {
+	var pages []Page
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !pageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		page, err := loadPage(path)
+		if err != nil {
+			return err
+		}
+		page.Path, _ = filepath.Rel(dir, path)
+		if page.URL == "" && baseURL != "" {
+			page.URL = strings.TrimRight(baseURL, "/") + "/" + filepath.ToSlash(page.Path)
+		}
+		if page.Title == "" {
+			page.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		pages = append(pages, page)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error loading pages from %s: %w", dir, err)
+	}
+	return pages, nil
+}
+
+// loadPage reads a single file and extracts its title, URL and text.
+func loadPage(path string) (Page, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Page{}, err
+	}
+	content := string(data)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		page := Page{Text: htmlToText(content)}
+		if match := titlePattern.FindStringSubmatch(content); match != nil {
+			page.Title = strings.TrimSpace(html.UnescapeString(match[1]))
+		}
+		if match := canonicalPattern.FindStringSubmatch(content); match != nil {
+			page.URL = match[1]
+		} else if match := ogURLPattern.FindStringSubmatch(content); match != nil {
+			page.URL = match[1]
+		}
+		return page, nil
+	case ".md":
+		return markdownPage(content), nil
+	default:
+		return Page{Text: strings.TrimSpace(content)}, nil
+	}
+}
+
+// markdownPage reads optional "---" front matter (title and url keys) and uses the
+// first heading as the title otherwise.
+func markdownPage(content string) Page {
+	var page Page
+	if strings.HasPrefix(content, "---") {
+		if end := strings.Index(content[3:], "\n---"); end >= 0 {
+			frontMatter := content[3 : end+3]
+			content = content[end+7:]
+			for _, line := range strings.Split(frontMatter, "\n") {
+				key, value, found := strings.Cut(line, ":")
+				if !found {
+					continue
+				}
+				value = strings.Trim(strings.TrimSpace(value), `"'`)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "title":
+					page.Title = value
+				case "url":
+					page.URL = value
+				}
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for page.Title == "" && scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "#") {
+			page.Title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+	}
+	page.Text = strings.TrimSpace(content)
+	return page
+}
+
+// htmlToText strips scripts, styles and tags from an HTML document, keeping block
+// boundaries as line breaks.
+func htmlToText(content string) string {
+	content = scriptPattern.ReplaceAllString(content, "")
+	content = titlePattern.ReplaceAllString(content, "")
+	content = blockTagPattern.ReplaceAllString(content, "\n")
+	content = tagPattern.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+	content = spacePattern.ReplaceAllString(content, " ")
+	content = blankLinePattern.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InstructorProfile aggregates everything the schedule says about one instructor.
+type InstructorProfile struct {
+	Name            string   `json:"name"`
+	Email           string   `json:"email"`
+	Departments     []string `json:"departments"`
+	Courses         []string `json:"courses"` // e.g. "CS 272-01 Software Development (CRN 41234)"
+	TotalEnrollment int      `json:"total_enrollment"`
+	MeetDays        []string `json:"meet_days"`
+	Buildings       []string `json:"buildings"`
+}
+
+// instructorName returns the canonical name of a section's instructor when one of the
+// known aliases matches, or the name as written in the schedule otherwise. Course
+// metadata, filters and profiles all name instructors this way.
+func instructorName(course Course) string {
+	fullName := strings.TrimSpace(course.InstructorFirstName + " " + course.InstructorLastName)
+	for _, instructor := range InitializeInstructors() {
+		for _, alias := range instructor.Aliases {
+			if strings.EqualFold(fullName, alias) {
+				return instructor.CanonicalName
+			}
+		}
+	}
+	return fullName
+}
+
+// BuildInstructorProfiles builds a profile for every instructor in the schedule, sorted
+// by name. Sections listed on several rows (one per meeting) are counted once.
+func BuildInstructorProfiles(courses []Course) []InstructorProfile {
+	type aggregate struct {
+		profile     InstructorProfile
+		departments map[string]bool
+		crns        map[string]bool
+		days        map[string]bool
+		buildings   map[string]bool
+	}
+	byName := make(map[string]*aggregate)
+
+	for _, course := range courses {
+		name := instructorName(course)
+		if name == "" {
+			continue
+		}
+		agg, ok := byName[name]
+		if !ok {
+			agg = &aggregate{
+				profile:     InstructorProfile{Name: name},
+				departments: make(map[string]bool),
+				crns:        make(map[string]bool),
+				days:        make(map[string]bool),
+				buildings:   make(map[string]bool),
+			}
+			byName[name] = agg
+		}
+
+		if agg.profile.Email == "" {
+			agg.profile.Email = course.InstructorEmail
+		}
+		agg.departments[course.Subject] = true
+		for _, day := range course.MeetDays {
+			agg.days[string(day)] = true
+		}
+		if course.Building != "" {
+			agg.buildings[course.Building] = true
+		}
+		if agg.crns[course.CRN] {
+			continue
+		}
+		agg.crns[course.CRN] = true
+		agg.profile.Courses = append(agg.profile.Courses,
+			fmt.Sprintf("%s %s-%s %s (CRN %s)", course.Subject, course.CourseNumber, course.Section, course.Title, course.CRN))
+		if enrollment, err := strconv.Atoi(course.ActualEnrollment); err == nil {
+			agg.profile.TotalEnrollment += enrollment
+		}
+	}
+
+	profiles := make([]InstructorProfile, 0, len(byName))
+	for _, agg := range byName {
+		agg.profile.Departments = sortedKeys(agg.departments)
+		agg.profile.MeetDays = sortedDays(agg.days)
+		agg.profile.Buildings = sortedKeys(agg.buildings)
+		profiles = append(profiles, agg.profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// Document renders the profile as the text stored in the instructors collection.
+func (p InstructorProfile) Document() string {
+	var doc strings.Builder
+	doc.WriteString(fmt.Sprintf("%s is an instructor in %s", p.Name, strings.Join(p.Departments, ", ")))
+	if p.Email != "" {
+		doc.WriteString(fmt.Sprintf(" (email: %s)", p.Email))
+	}
+	doc.WriteString(fmt.Sprintf(". %s courses:\n", scheduleTerm))
+	for _, course := range p.Courses {
+		doc.WriteString("- " + course + "\n")
+	}
+	doc.WriteString(fmt.Sprintf("Total enrollment: %d.", p.TotalEnrollment))
+	if len(p.MeetDays) > 0 {
+		doc.WriteString(" Meets on: " + strings.Join(p.MeetDays, ", ") + ".")
+	}
+	if len(p.Buildings) > 0 {
+		doc.WriteString(" Teaches in buildings: " + strings.Join(p.Buildings, ", ") + ".")
+	}
+	return doc.String()
+}
+
+// Metadata returns the profile fields stored alongside the document.
+func (p InstructorProfile) Metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"kind":                      "instructor_profile",
+		"instructor_canonical_name": p.Name,
+		"email":                     p.Email,
+		"departments":               strings.Join(p.Departments, ","),
+		"total_enrollment":          p.TotalEnrollment,
+	}
+}
+
+// FindInstructorProfile looks up a profile by full name, known alias, or a first or
+// last name that belongs to exactly one instructor.
+func FindInstructorProfile(profiles []InstructorProfile, name string) (*InstructorProfile, bool) {
+	name = strings.Trim(strings.TrimSpace(name), "?.!")
+	if name == "" {
+		return nil, false
+	}
+	for _, instructor := range InitializeInstructors() {
+		for _, alias := range instructor.Aliases {
+			if strings.EqualFold(name, alias) {
+				name = instructor.CanonicalName
+			}
+		}
+	}
+
+	var partial []int
+	for i, profile := range profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return &profiles[i], true
+		}
+		for _, part := range strings.Fields(profile.Name) {
+			if strings.EqualFold(part, name) {
+				partial = append(partial, i)
+				break
+			}
+		}
+	}
+	if len(partial) == 1 {
+		return &profiles[partial[0]], true
+	}
+	return nil, false
+}
+
+// handleLookupInstructor runs the lookup_instructor tool.
+func (bot *ChatBot) handleLookupInstructor(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	profile, ok := FindInstructorProfile(bot.profiles, args.Name)
+	if !ok {
+		return fmt.Sprintf("No instructor named '%s' teaches in the %s schedule.", args.Name, scheduleTerm), nil
+	}
+	result, err := json.Marshal(profile)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// sortedKeys returns the keys of a set or map in sorted order.
+func sortedKeys[V any](set map[string]V) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// weekOrder is the order of the schedule's meeting day codes.
+const weekOrder = "MTWRFSU"
+
+// sortedDays returns meeting day codes in week order.
+func sortedDays(set map[string]bool) []string {
+	var days []string
+	for _, day := range weekOrder {
+		if set[string(day)] {
+			days = append(days, string(day))
+		}
+	}
+	return days
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// builtinPrompts holds the prompt templates the assistant ships with.
+//
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+// Prompt templates, each stored as <name>.tmpl.
+const (
+	promptSystem  = "system"   // Opens every conversation; rendered with PromptData
+	promptContext = "context"  // Presents the retrieved documents; rendered with PromptData
+	promptNoMatch = "no_match" // Sent when nothing relevant was retrieved in a follow-up; rendered with PromptData
+	promptSummary = "summary"  // Kept in the conversation in place of the context, if enabled; rendered with PromptData
+)
+
+var promptNames = []string{promptSystem, promptContext, promptNoMatch, promptSummary}
+
+// promptFuncs are available to every prompt template.
+var promptFuncs = template.FuncMap{
+	"times":      courseTimes,    // Days and times of a schedule row, such as "TR 1:30 PM-3:10 PM"
+	"instructor": instructorName, // Instructor of a schedule row
+}
+
+// promptVersionPattern finds the version a template declares in a leading comment,
+// such as {{/* version: 2 */}}.
+var promptVersionPattern = regexp.MustCompile(`^\{\{-?\s*/\*\s*version:\s*(\S+)\s*\*/`)
+
+// Prompts are the named templates the assistant renders its prompts from. Each
+// template has a version, so answers, logs and eval reports can be traced back to the
+// prompts that produced them and prompt changes compared against each other.
+type Prompts struct {
+	templates map[string]*template.Template
+	versions  map[string]string
+}
+
+// PromptData is what prompt templates are rendered with.
+type PromptData struct {
+	Session       string           // Conversation ID
+	Now           time.Time        // Current campus time
+	Term          string           // Term the schedule covers, such as Fall 2024
+	Question      string           // Question being answered, with instructor aliases resolved
+	Documents     []PromptDocument // Relevant retrieved documents, most relevant first
+	TimeNote      string           // Classes meeting at the time the question asks about, if it asks
+	NotInSchedule string           // Reply to give when the schedule has no answer
+}
+
+// PromptDocument is one retrieved document as prompt templates see it.
+type PromptDocument struct {
+	ID      string
+	Text    string  // The document as stored
+	Source  string  // File a university page chunk came from; empty for schedule rows
+	Catalog string  // Catalog description and prerequisites of a schedule row, if known
+	Course  *Course // The schedule row, nil for other documents
+}
+
+// defaultPrompts are the built-in templates.
+var defaultPrompts = mustLoadPrompts("")
+
+func mustLoadPrompts(dir string) *Prompts {
+	prompts, err := LoadPrompts(dir)
+	if err != nil {
+		panic(err)
+	}
+	return prompts
+}
+
+// LoadPrompts reads the built-in prompt templates, replacing any that have a file of
+// the same name in dir. An empty dir uses only the built-in templates.
+func LoadPrompts(dir string) (*Prompts, error) {
+	prompts := &Prompts{templates: make(map[string]*template.Template), versions: make(map[string]string)}
+	for _, name := range promptNames {
+		text, err := fs.ReadFile(builtinPrompts, "prompts/"+name+".tmpl")
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			override, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+			if err == nil {
+				text = override
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("Failed to read prompt %s: %w", name, err)
+			}
+		}
+		tmpl, err := template.New(name).Funcs(promptFuncs).Option("missingkey=error").Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing prompt %s: %w", name, err)
+		}
+		prompts.templates[name] = tmpl
+		prompts.versions[name] = promptVersion(text)
+	}
+	return prompts, nil
+}
+
+// promptVersion returns the version a template declares, or a hash of its text if it
+// declares none, so edited templates are told apart either way.
+func promptVersion(text []byte) string {
+	if match := promptVersionPattern.FindSubmatch(text); match != nil {
+		return string(match[1])
+	}
+	sum := sha256.Sum256(text)
+	return "sha-" + hex.EncodeToString(sum[:4])
+}
+
+// Version identifies the whole set of templates, such as
+// "context@1,no_match@1,summary@1,system@1".
+func (p *Prompts) Version() string {
+	versions := make([]string, 0, len(p.versions))
+	for name, version := range p.versions {
+		versions = append(versions, name+"@"+version)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ",")
+}
+
+// Render renders the named template. Surrounding whitespace is trimmed, so templates
+// may end in a newline.
+func (p *Prompts) Render(name string, data PromptData) (string, error) {
+	tmpl, ok := p.templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt %q", name)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("Failed to render prompt %s@%s: %w", name, p.versions[name], err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// promptData collects what the prompts of a question are rendered with.
+func (bot *ChatBot) promptData(session *Session, question string, documents []RetrievedDocument, timeNote string) PromptData {
+	data := PromptData{
+		Session:       session.ID,
+		Now:           bot.clock.Now().In(campusLocation),
+		Term:          scheduleTerm,
+		Question:      question,
+		TimeNote:      timeNote,
+		NotInSchedule: notInScheduleAnswer(),
+	}
+	for _, doc := range documents {
+		document := PromptDocument{ID: doc.ID, Text: doc.Document, Source: documentSource(doc)}
+		if document.Source == "" {
+			document.Catalog = bot.catalogNote(doc)
+			var course Course
+			if err := json.Unmarshal([]byte(doc.Document), &course); err == nil {
+				document.Course = &course
+			}
+		}
+		data.Documents = append(data.Documents, document)
+	}
+	return data
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinPrompts(t *testing.T) {
+	if got, want := defaultPrompts.Version(), "context@1,no_match@1,summary@1,system@1"; got != want {
+		t.Errorf("Expected version %s, got %s", want, got)
+	}
+
+	data := PromptData{
+		Documents: []PromptDocument{
+			{Text: `{"crn":"41001"}`, Catalog: " Catalog: Basics (4 units)."},
+			{Text: "Office hours are posted.", Source: "cs.html"},
+		},
+		TimeNote: "Classes meeting Monday 10:00: CS 110.",
+	}
+	want := "Based on the available information, here are the relevant matches:\n\n" +
+		"- {\"crn\":\"41001\"} Catalog: Basics (4 units).\n" +
+		"- [source: cs.html] Office hours are posted.\n" +
+		"\nClasses meeting Monday 10:00: CS 110.\n" +
+		"\nPlease use this information to answer the user's question. When you use a match marked with a source, cite that source file in your answer."
+	if got, err := defaultPrompts.Render(promptContext, data); err != nil || got != want {
+		t.Errorf("Expected context prompt\n%q\ngot\n%q (%v)", want, got, err)
+	}
+
+	data = PromptData{NotInSchedule: notInScheduleAnswer()}
+	if got, _ := defaultPrompts.Render(promptNoMatch, data); !strings.HasSuffix(got, `reply exactly: "`+notInScheduleAnswer()+`" Never invent courses, instructors, rooms or times.`) {
+		t.Errorf("Expected the no match prompt to quote the reply, got %q", got)
+	}
+}
+
+func TestPromptOverrides(t *testing.T) {
+	dir := t.TempDir()
+	system := "{{/* version: terse */ -}}\nYou answer questions about the {{.Term}} schedule for {{.Session}}. Be brief.\n"
+	if err := os.WriteFile(filepath.Join(dir, "system.tmpl"), []byte(system), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := LoadPrompts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prompts.Version(), "context@1,no_match@1,summary@1,system@terse"; got != want {
+		t.Errorf("Expected version %s, got %s", want, got)
+	}
+
+	courses := []Course{{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science"}}
+	chatbot := NewChatBot(echoLLM(t, nil), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetPrompts(prompts)
+	session := NewSession("alice")
+	if _, err := chatbot.Answer(context.Background(), session, "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+	messages := session.Messages()
+	if got, want := messages[0].Content, "You answer questions about the Fall 2024 schedule for alice. Be brief."; got != want {
+		t.Errorf("Expected the overridden system prompt %q, got %q", want, got)
+	}
+
+	// Templates without a version are told apart by their text
+	if err := os.WriteFile(filepath.Join(dir, "system.tmpl"), []byte("You help with courses."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if prompts, err := LoadPrompts(dir); err != nil || !strings.Contains(prompts.Version(), "system@sha-") {
+		t.Errorf("Expected a hashed version, got %v (%v)", prompts, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "context.tmpl"), []byte("{{range .Documents}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPrompts(dir); err == nil || !strings.Contains(err.Error(), "context") {
+		t.Errorf("Expected a parse error naming the prompt, got %v", err)
+	}
+}
@@ -5,72 +5,77 @@ import(
 	"context"
 	"encoding/json"
 	"strconv"
-	"os"
-	"log"
+	"sort"
+	"log/slog"
 	"fmt"
 	"time"
 	
 	chroma "github.com/amikos-tech/chroma-go"
 	"github.com/amikos-tech/chroma-go/openai"
+	"github.com/amikos-tech/chroma-go/types"
 )
 
 
 
-// Add adds a list of Course objects to the ChromaDB collection
-func Add(courses []Course) (context.Context, *chroma.Client, *chroma.Collection, *chroma.Collection) {
-    openaikey := os.Getenv("OPENAI_PROJECT_KEY")
-    if openaikey == "" {
-        log.Fatalf("OPENAI_PROJECT_KEY not set in environment variables")
+// Add adds a list of Course objects to the ChromaDB collection. Connection, embedding
+// and collection failures are returned as a *StoreError so callers can fall back to the
+// in-process course data.
+func Add(ctx context.Context, cfg *Config, courses []Course) (*chroma.Client, *chroma.Collection, *chroma.Collection, error) {
+    if cfg.OpenAI.APIKey == "" {
+        return nil, nil, nil, ErrMissingAPIKey
     }
 
-    ctx := context.TODO()
-    client, err := chroma.NewClient("http://localhost:8000")
+    client, err := newChromaClient(cfg.Chroma.URL)
     if err != nil {
-        log.Fatalf("Failed to create client: %v", err)
+        return nil, nil, nil, &StoreError{Op: "connect", Err: err}
     }
 
-    openaiEf, err := openai.NewOpenAIEmbeddingFunction(openaikey)
+    openaiEf, err := newEmbeddingFunction(cfg)
     if err != nil {
-        log.Fatalf("Error creating OpenAI embedding function: %s", err)
+        return nil, nil, nil, &StoreError{Op: "create embedding function", Err: err}
     }
 
     // Get or create the courses collection
-    coursesCollection, err := client.GetCollection(ctx, "courses-collection", openaiEf)
+    coursesCollection, err := client.CreateCollection(ctx, cfg.Chroma.CoursesCollection, nil, true, openaiEf, types.L2)
     if err != nil {
-        log.Fatalf("Failed to get courses collection: %v", err)
+        return nil, nil, nil, &StoreError{Op: "open", Collection: cfg.Chroma.CoursesCollection, Err: err}
     }
 
     // Get or create the instructors collection
-    instructorsCollection, err := client.GetCollection(ctx, "instructors-collection", openaiEf)
+    instructorsCollection, err := client.CreateCollection(ctx, cfg.Chroma.InstructorsCollection, nil, true, openaiEf, types.L2)
     if err != nil {
-        log.Fatalf("Failed to get instructors collection: %v", err)
+        return nil, nil, nil, &StoreError{Op: "open", Collection: cfg.Chroma.InstructorsCollection, Err: err}
+    }
+
+    // Instructor profiles are refreshed on every start, even if courses were loaded earlier
+    if err := addInstructorProfiles(ctx, instructorsCollection, courses); err != nil {
+        slog.WarnContext(ctx, "Failed to add instructor profiles", "err", err)
     }
 
     // Check if there are existing documents in the courses collection
     testQueryResults, err := coursesCollection.Query(ctx, []string{"test"}, 1, nil, nil, nil)
-    if err == nil && len(testQueryResults.Documents) > 0 {
-        fmt.Println("Courses already loaded in ChromaDB, skipping addition.")
-        return ctx, client, coursesCollection, instructorsCollection
+    if err == nil && len(testQueryResults.Documents) > 0 && len(testQueryResults.Documents[0]) > 0 {
+        slog.InfoContext(ctx, "Courses already loaded in ChromaDB, skipping addition")
+        return client, coursesCollection, instructorsCollection, nil
     }
 
-    instructors := InitializeInstructors()
-    uniqueInstructorNames := make(map[string]struct{}) // Track unique instructors
-
-    fmt.Printf("Adding %d courses to the collection...\n", len(courses))
+    slog.InfoContext(ctx, "Adding courses to the collection", "courses", len(courses))
+    failed := 0
+    var lastErr error
     for i, course := range courses {
-        fullName := course.InstructorFirstName + " " + course.InstructorLastName
-        canonicalName := findCanonicalName(fullName, instructors)
-
-        // Track unique instructor canonical names
-        uniqueInstructorNames[canonicalName] = struct{}{}
+        // Stop loading if the caller gave up, keeping the courses stored so far
+        if err := ctx.Err(); err != nil {
+            return client, coursesCollection, instructorsCollection, &StoreError{Op: "add", Collection: cfg.Chroma.CoursesCollection, Err: err}
+        }
 
+        // Profiles and filters resolve names the same way, so they agree on each instructor
         metadata := map[string]interface{}{
-            "instructor_canonical_name": canonicalName,
+            "instructor_canonical_name": instructorName(course),
         }
 		
         jsonData, err := json.Marshal(course)
         if err != nil {
-            log.Printf("Failed to marshal course to JSON: %v", err)
+            slog.WarnContext(ctx, "Failed to marshal course to JSON", "crn", course.CRN, "err", err)
             continue
         }
 
@@ -78,55 +83,178 @@ func Add(courses []Course) (context.Context, *chroma.Client, *chroma.Collection,
         documentID := strconv.Itoa(i)
 
         // Use retry mechanism to add the course
-        fmt.Printf("Processing course %d of %d: %s\n", i+1, len(courses), course.Title)
-        addCourseWithRetry(ctx, coursesCollection, []map[string]interface{}{metadata}, []string{string(jsonData)}, []string{documentID})
+        slog.DebugContext(ctx, "Processing course", "course", i+1, "of", len(courses), "title", course.Title)
+        if err := addCourseWithRetry(ctx, coursesCollection, []map[string]interface{}{metadata}, []string{string(jsonData)}, []string{documentID}, cfg.Chroma.AddRetries); err != nil {
+            failed++
+            lastErr = err
+        }
+    }
+
+    // Courses that were stored are still searchable, so report partial failures with the collections
+    if failed > 0 {
+        err := &StoreError{Op: "add", Collection: cfg.Chroma.CoursesCollection, Err: fmt.Errorf("%d of %d courses not stored: %w", failed, len(courses), lastErr)}
+        return client, coursesCollection, instructorsCollection, err
+    }
+
+    slog.InfoContext(ctx, "Finished adding courses and instructors to the collections")
+    return client, coursesCollection, instructorsCollection, nil
+}
+
+// Reindex drops the course and instructor collections and adds the courses again.
+func Reindex(ctx context.Context, cfg *Config, courses []Course) (*chroma.Client, *chroma.Collection, *chroma.Collection, error) {
+    client, err := newChromaClient(cfg.Chroma.URL)
+    if err != nil {
+        return nil, nil, nil, &StoreError{Op: "connect", Err: err}
     }
+    for _, name := range []string{cfg.Chroma.CoursesCollection, cfg.Chroma.InstructorsCollection} {
+        if _, err := client.DeleteCollection(ctx, name); err != nil {
+            slog.WarnContext(ctx, "Could not delete collection", "collection", name, "err", err)
+        }
+    }
+    return Add(ctx, cfg, courses)
+}
 
-    fmt.Printf("Adding %d unique instructors to the collection...\n", len(uniqueInstructorNames))
-    for name := range uniqueInstructorNames {
-        // Unique document ID for the instructor
-        instructorID := name
+// addInstructorProfiles stores one profile document per instructor, keyed by name, and
+// deletes the profiles of instructors no longer in the schedule. Upserting replaces the
+// profiles stored by earlier runs, and the bare names stored by older versions.
+func addInstructorProfiles(ctx context.Context, collection *chroma.Collection, courses []Course) error {
+    profiles := BuildInstructorProfiles(courses)
+    slog.InfoContext(ctx, "Adding instructor profiles to the collection", "profiles", len(profiles))
+    names := make([]string, 0, len(profiles))
+    for start := 0; start < len(profiles); start += ingestBatch {
+        end := min(start+ingestBatch, len(profiles))
+        var ids, documents []string
+        var metadatas []map[string]interface{}
+        for _, profile := range profiles[start:end] {
+            ids = append(ids, profile.Name)
+            documents = append(documents, profile.Document())
+            metadatas = append(metadatas, profile.Metadata())
+        }
+        if _, err := collection.Upsert(ctx, nil, metadatas, documents, ids); err != nil {
+            return fmt.Errorf("failed to store profiles %d-%d: %w", start, end-1, err)
+        }
+        names = append(names, ids...)
+    }
 
-        // Add instructor name to the instructors collection
-        addCourseWithRetry(ctx, instructorsCollection, nil, []string{name}, []string{instructorID})
+    where := map[string]interface{}{"kind": "instructor_profile"}
+    if len(names) > 0 {
+        where = map[string]interface{}{"$and": []map[string]interface{}{
+            where,
+            {"instructor_canonical_name": map[string]interface{}{"$nin": names}},
+        }}
+    }
+    deleted, err := collection.Delete(ctx, nil, where, nil)
+    if err != nil {
+        return fmt.Errorf("failed to delete stale profiles: %w", err)
     }
+    if len(deleted) > 0 {
+        slog.InfoContext(ctx, "Deleted stale instructor profiles", "deleted", len(deleted))
+    }
+    return nil
+}
 
-    fmt.Println("Finished adding courses and instructors to the collections.")
-    return ctx, client, coursesCollection, instructorsCollection
+// newEmbeddingFunction creates the OpenAI embedding function shared by all collections,
+// wrapped with the on-disk embedding cache when one is configured.
+func newEmbeddingFunction(cfg *Config) (types.EmbeddingFunction, error) {
+    ef, err := openai.NewOpenAIEmbeddingFunction(cfg.OpenAI.APIKey, openai.WithModel(openai.EmbeddingModel(cfg.Embedding.Model)), withEmbeddingHTTPClient())
+    if err != nil {
+        return nil, err
+    }
+    // Usage is recorded beneath the cache, so only embeddings actually computed count
+    metered := &meteredEmbeddingFunction{inner: ef, model: cfg.Embedding.Model}
+    if cfg.Embedding.CachePath == "" {
+        return metered, nil
+    }
+    cache, err := sharedEmbeddingCache(cfg.Embedding.CachePath)
+    if err != nil {
+        return nil, err
+    }
+    return &cachedEmbeddingFunction{inner: metered, model: cfg.Embedding.Model, cache: cache}, nil
 }
 
-// addCourseWithRetry handles adding a document to the ChromaDB collection with retries.
-func addCourseWithRetry(ctx context.Context, collection *chroma.Collection, metadata []map[string]interface{}, documents []string, ids []string) {
-    retries := 3 // Maximum number of retries
+// addCourseWithRetry handles adding a document to the ChromaDB collection with retries,
+// returning the last error if every attempt fails.
+func addCourseWithRetry(ctx context.Context, collection *chroma.Collection, metadata []map[string]interface{}, documents []string, ids []string, retries int) error {
     var err error
 
     for i := 0; i < retries; i++ {
         _, err = collection.Add(ctx, nil, metadata, documents, ids)
         if err == nil {
-            fmt.Printf("Successfully added document with ID: %s\n", ids[0])
-            return
+            slog.DebugContext(ctx, "Added document", "id", ids[0])
+            return nil
+        }
+        slog.WarnContext(ctx, "Failed to add document, retrying", "id", ids[0], "attempt", i+1, "err", err)
+        if i+1 < retries {
+            metrics.storeAddRetries.Add(1)
+        }
+        select {
+        case <-time.After(time.Second * time.Duration(i+1)): // Exponential backoff
+        case <-ctx.Done():
+            return ctx.Err()
         }
-        log.Printf("Retry %d: Failed to add document with ID %s: %v", i+1, ids[0], err)
-        time.Sleep(time.Second * time.Duration(i+1)) // Exponential backoff
     }
 
     // If all retries fail, log the final error
-    log.Printf("Failed to add document with ID %s after %d retries: %v", ids[0], retries, err)
+    slog.ErrorContext(ctx, "Failed to add document", "id", ids[0], "retries", retries, "err", err)
+    metrics.storeAddFailures.Add(1)
+    return err
 }
 
-// Query searches the ChromaDB collection for a term and retrieves matching documents
-func Query(ctx context.Context, client *chroma.Client, collection *chroma.Collection, term string) [][]string {
-    terms := []string{term}
-    
+// RetrievedDocument is a single match returned by Query along with its distance from the query.
+type RetrievedDocument struct {
+	ID       string
+	Document string
+	Metadata map[string]interface{}
+	Distance float32
+}
 
-    queryResults, err := collection.Query(ctx, terms, 10, nil, nil, nil)
-    if err != nil {
-        log.Fatalf("failed to query collection: %v", err)
-    }
+// Query searches the ChromaDB collection for a term and retrieves matching documents,
+// closest match first. A failed query is returned as a *StoreError.
+func Query(ctx context.Context, client *chroma.Client, collection *chroma.Collection, term string, nResults int) ([]RetrievedDocument, error) {
+	terms := []string{term}
+
+	queryResults, err := collection.Query(ctx, terms, int32(nResults), nil, nil, nil)
+	if err != nil {
+		return nil, &StoreError{Op: "query", Collection: collection.Name, Err: err}
+	}
 
-    documents := queryResults.Documents
+	var documents []RetrievedDocument
+	for i, docs := range queryResults.Documents {
+		for j, doc := range docs {
+			retrieved := RetrievedDocument{Document: doc}
+			if i < len(queryResults.Ids) && j < len(queryResults.Ids[i]) {
+				retrieved.ID = queryResults.Ids[i][j]
+			}
+			if i < len(queryResults.Metadatas) && j < len(queryResults.Metadatas[i]) {
+				retrieved.Metadata = queryResults.Metadatas[i][j]
+			}
+			if i < len(queryResults.Distances) && j < len(queryResults.Distances[i]) {
+				retrieved.Distance = queryResults.Distances[i][j]
+			}
+			documents = append(documents, retrieved)
+		}
+	}
 
-    return documents
+	return documents, nil
 }
 
+// relevantDocuments keeps only the documents whose distance is within maxDistance.
+func relevantDocuments(documents []RetrievedDocument, maxDistance float32) []RetrievedDocument {
+	var relevant []RetrievedDocument
+	for _, doc := range documents {
+		if doc.Distance <= maxDistance {
+			relevant = append(relevant, doc)
+		}
+	}
+	return relevant
+}
 
+// mergeDocuments combines results from two collections, closest first, keeping at most limit.
+func mergeDocuments(a, b []RetrievedDocument, limit int) []RetrievedDocument {
+	merged := append(append([]RetrievedDocument{}, a...), b...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Distance < merged[j].Distance })
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// repl holds what the interactive chat keeps between questions besides the conversation.
+type repl struct {
+	chatbot *ChatBot
+	editor  *LineEditor
+	out     io.Writer
+	style   TableStyle
+	debug   bool    // Trace how each answer was found
+	last    *Answer // Most recent answer, for /export
+}
+
+// replCommand describes a slash command for /help.
+type replCommand struct {
+	name, args, help string
+}
+
+var replCommands = []replCommand{
+	{"/help", "", "List these commands"},
+	{"/reset", "", "Start the conversation over"},
+	{"/history", "[N]", "Show the last N lines entered (default 20)"},
+	{"/save", "FILE", "Save the conversation as text"},
+	{"/export", "FILE", "Save the sections cited by the last answer as CSV, or JSON if FILE ends in .json"},
+	{"/term", "", "Show the term the schedule covers"},
+	{"/model", "[NAME]", "Show or change the chat model"},
+	{"/courses", "NAME", "List an instructor's sections"},
+	{"/room", "BLDG RM [DAY [TIME]]", "Show a room's week, or whether it is in use"},
+	{"/free", "[BLDG] DAY START-END", "List the rooms free in a time window"},
+	{"/debug", "", "Toggle tracing how each answer was found"},
+	{"/stats", "", "Show the tokens used and their estimated cost"},
+	{"/quit", "", "Leave"},
+}
+
+// replWords are the commands that are not slash commands, offered by tab completion.
+var replWords = []string{"who"}
+
+// defaultHistoryLines is how many lines /history shows without an argument.
+const defaultHistoryLines = 20
+
+// command runs a slash command and reports whether the chat should end.
+func (r *repl) command(line string) bool {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	args = strings.TrimSpace(args)
+	switch strings.ToLower(name) {
+	case "/quit", "/exit":
+		return true
+	case "/help":
+		for _, command := range replCommands {
+			fmt.Fprintf(r.out, "  %-26s %s\n", strings.TrimSpace(command.name+" "+command.args), command.help)
+		}
+		fmt.Fprintln(r.out, "  who NAME                   Show an instructor's profile")
+	case "/reset":
+		r.chatbot.Session().Reset()
+		r.last = nil
+		fmt.Fprintln(r.out, "Started a new conversation.")
+	case "/history":
+		n := defaultHistoryLines
+		if args != "" {
+			parsed, err := strconv.Atoi(args)
+			if err != nil || parsed < 1 {
+				fmt.Fprintln(r.out, "Usage: /history [N]")
+				return false
+			}
+			n = parsed
+		}
+		history := r.editor.History()
+		first := max(len(history)-n, 0)
+		for i, line := range history[first:] {
+			fmt.Fprintf(r.out, "%5d  %s\n", first+i+1, line)
+		}
+	case "/save":
+		if args == "" {
+			fmt.Fprintln(r.out, "Usage: /save FILE")
+			return false
+		}
+		if err := saveFile(args, func(w io.Writer) error {
+			return writeTranscript(w, r.chatbot.Session().Messages())
+		}); err != nil {
+			fmt.Fprintf(r.out, "Error saving the conversation: %v\n", err)
+			return false
+		}
+		fmt.Fprintf(r.out, "Saved the conversation to %s.\n", args)
+	case "/export":
+		if args == "" {
+			fmt.Fprintln(r.out, "Usage: /export FILE")
+			return false
+		}
+		if r.last == nil || len(r.last.Sections) == 0 {
+			fmt.Fprintln(r.out, "The last answer did not cite any sections.")
+			return false
+		}
+		if err := saveFile(args, func(w io.Writer) error {
+			if strings.EqualFold(filepath.Ext(args), ".json") {
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(r.last.Sections)
+			}
+			return writeCourseCSV(w, r.last.Sections)
+		}); err != nil {
+			fmt.Fprintf(r.out, "Error exporting sections: %v\n", err)
+			return false
+		}
+		fmt.Fprintf(r.out, "Exported %d sections to %s.\n", len(r.last.Sections), args)
+	case "/term":
+		fmt.Fprintln(r.out, termDescription(r.chatbot.metadata.courses))
+		fmt.Fprintf(r.out, "Today is %s.\n", r.chatbot.clock.Now().Format("Monday, January 2 2006"))
+	case "/model":
+		if args != "" {
+			r.chatbot.SetModel(args)
+			fmt.Fprintf(r.out, "Now answering with %s.\n", args)
+			return false
+		}
+		fmt.Fprintf(r.out, "Answering with %s.\n", r.chatbot.Model())
+	case "/debug":
+		r.debug = !r.debug
+		if r.debug {
+			fmt.Fprintln(r.out, "Debug output on: each answer is followed by a trace of how it was found.")
+		} else {
+			fmt.Fprintln(r.out, "Debug output off.")
+		}
+	case "/courses":
+		if args == "" {
+			fmt.Fprintln(r.out, "Usage: /courses NAME")
+			return false
+		}
+		ctx, stop := interruptContext()
+		fmt.Fprint(r.out, r.chatbot.QueryCourses(ctx, args, r.style))
+		stop()
+	case "/room":
+		fmt.Fprintln(r.out, roomCommand(r.chatbot.Rooms(), args))
+	case "/free":
+		fmt.Fprintln(r.out, freeRoomCommand(r.chatbot.Rooms(), args))
+	case "/stats":
+		writeUsage(r.out, r.chatbot.Usage().Stats(), r.chatbot.Session().ID, r.chatbot.clock.Now())
+	default:
+		fmt.Fprintf(r.out, "Unknown command %s. Type /help for the list of commands.\n", name)
+	}
+	return false
+}
+
+// termDescription names the schedule's term and the dates its classes meet.
+func termDescription(courses []Course) string {
+	first, last := termDates(courses)
+	if first.IsZero() {
+		return fmt.Sprintf("The schedule covers %s.", scheduleTerm)
+	}
+	return fmt.Sprintf("The schedule covers %s, with classes from %s to %s.",
+		scheduleTerm, first.Format("January 2 2006"), last.Format("January 2 2006"))
+}
+
+// saveFile writes a file with write, reporting failures to create or close it.
+func saveFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeTranscript writes the questions and answers of a conversation as text.
+func writeTranscript(w io.Writer, messages []openai.ChatCompletionMessage) error {
+	var b strings.Builder
+	for _, message := range messages {
+		switch {
+		case message.Role == openai.ChatMessageRoleUser:
+			fmt.Fprintf(&b, "You: %s\n\n", message.Content)
+		case message.Role == openai.ChatMessageRoleAssistant && message.Content != "":
+			fmt.Fprintf(&b, "ChatBot: %s\n\n", message.Content)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// scheduleCompleter completes commands, subjects, instructor names and CRNs from the
+// schedule. Longer fragments are tried first, so names with spaces complete as a whole.
+func scheduleCompleter(metadata *MetadataExtractor) func([]rune) (int, []string) {
+	seen := make(map[string]bool)
+	var words []string
+	add := func(word string) {
+		word = strings.TrimSpace(word)
+		if word != "" && !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	for _, command := range replCommands {
+		add(command.name)
+	}
+	for _, word := range replWords {
+		add(word)
+	}
+	for _, subject := range metadata.Departments {
+		add(subject)
+	}
+	for _, name := range metadata.Instructors {
+		add(name)
+	}
+	for _, course := range metadata.courses {
+		add(course.CRN)
+	}
+	sort.Strings(words)
+
+	return func(line []rune) (int, []string) {
+		for start := 0; start < len(line); start++ {
+			if start > 0 && line[start-1] != ' ' {
+				continue
+			}
+			fragment := strings.ToLower(string(line[start:]))
+			var matches []string
+			for _, word := range words {
+				if strings.HasPrefix(strings.ToLower(word), fragment) {
+					matches = append(matches, word)
+				}
+			}
+			if len(matches) > 0 {
+				return start, matches
+			}
+		}
+		return len(line), nil
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestREPLCommands(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "40630", Title: "Intro to Computer Science", InstructorFirstName: "Julia", InstructorLastName: "Nolfo",
+			MeetStart: "8/26/24", MeetEnd: "12/13/24"},
+	}
+	chatbot := NewChatBot(echoLLM(t, nil), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetClock(fixedClock(time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)))
+	editor := newLineEditor(strings.NewReader("first\nsecond\nthird\n"), io.Discard, false)
+	for i := 0; i < 3; i++ {
+		editor.ReadLine("> ")
+	}
+	var out strings.Builder
+	r := &repl{chatbot: chatbot, editor: editor, out: &out}
+	run := func(line string) string {
+		out.Reset()
+		if r.command(line) {
+			t.Errorf("Expected %s not to end the chat", line)
+		}
+		return out.String()
+	}
+
+	if _, err := chatbot.AnswerQuestion(context.Background(), "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	transcript := filepath.Join(dir, "chat.txt")
+	run("/save " + transcript)
+	if data, _ := os.ReadFile(transcript); string(data) != "You: Who teaches CS 110?\n\nChatBot: answer to Who teaches CS 110?\n\n" {
+		t.Errorf("Unexpected transcript %q", data)
+	}
+	if output := run("/reset"); len(chatbot.Session().Messages()) != 1 || !strings.Contains(output, "new conversation") {
+		t.Errorf("Expected /reset to clear the conversation, got %q", output)
+	}
+
+	if output := run("/history 2"); output != "    2  second\n    3  third\n" {
+		t.Errorf("Unexpected /history output %q", output)
+	}
+	if output := run("/term"); !strings.Contains(output, "Fall 2024, with classes from August 26 2024 to December 13 2024") ||
+		!strings.Contains(output, "Tuesday, October 22 2024") {
+		t.Errorf("Unexpected /term output %q", output)
+	}
+	run("/model gpt-4o")
+	if output := run("/model"); chatbot.Model() != "gpt-4o" || output != "Answering with gpt-4o.\n" {
+		t.Errorf("Expected the model to change, got %q", output)
+	}
+	if run("/debug"); !r.debug {
+		t.Error("Expected /debug to turn debug output on")
+	}
+
+	if output := run("/export " + filepath.Join(dir, "none.csv")); !strings.Contains(output, "did not cite") {
+		t.Errorf("Expected nothing to export before an answer, got %q", output)
+	}
+	r.last = &Answer{Sections: courses}
+	run("/export " + filepath.Join(dir, "sections.csv"))
+	if data, _ := os.ReadFile(filepath.Join(dir, "sections.csv")); !strings.HasPrefix(string(data), "Course,CRN,") || !strings.Contains(string(data), "40630") {
+		t.Errorf("Unexpected CSV export %q", data)
+	}
+	run("/export " + filepath.Join(dir, "sections.json"))
+	var exported []Course
+	if data, _ := os.ReadFile(filepath.Join(dir, "sections.json")); json.Unmarshal(data, &exported) != nil || len(exported) != 1 || exported[0].CRN != "40630" {
+		t.Errorf("Unexpected JSON export %q", data)
+	}
+
+	// Course listings are a slash command, so questions starting with "courses" reach the chatbot
+	if output := run("/courses Phil Peterson"); !strings.HasPrefix(output, "Here are the courses taught by Philip Peterson") {
+		t.Errorf("Unexpected /courses output %q", output)
+	}
+	// Room lookups are slash commands, so questions starting with "room" or "free" reach the chatbot
+	if output := run("/room HR"); !strings.HasPrefix(output, "Usage: /room") {
+		t.Errorf("Unexpected /room output %q", output)
+	}
+	if output := run("/free monday 9am-11am"); output != "No scheduled rooms are free in that window.\n" {
+		t.Errorf("Unexpected /free output %q", output)
+	}
+
+	if output := run("/nonsense"); !strings.Contains(output, "Unknown command /nonsense") {
+		t.Errorf("Unexpected output %q", output)
+	}
+	if !r.command("/quit") {
+		t.Error("Expected /quit to end the chat")
+	}
+}
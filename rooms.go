@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Meeting is one weekly meeting of a section in a room.
+type Meeting struct {
+	Course Course
+	Day    byte // Schedule day code: M, T, W, R, F, S or U
+	Start  int  // Minutes after midnight
+	End    int
+}
+
+// Overlaps reports whether the meeting overlaps the window [start, end).
+func (m Meeting) Overlaps(start, end int) bool {
+	return m.Start < end && start < m.End
+}
+
+// String renders the meeting as "10:30 AM-12:10 PM CS 272-01".
+func (m Meeting) String() string {
+	return fmt.Sprintf("%s-%s %s %s-%s", formatClock(m.Start), formatClock(m.End), m.Course.Subject, m.Course.CourseNumber, m.Course.Section)
+}
+
+// courseMeetings expands a schedule row into one meeting per meeting day. Rows without
+// days or times (online, TBA) have no meetings.
+func courseMeetings(course Course) []Meeting {
+	start, okStart := parseClock(course.BeginTime)
+	end, okEnd := parseClock(course.EndTime)
+	if !okStart || !okEnd {
+		return nil
+	}
+	var meetings []Meeting
+	for i := 0; i < len(course.MeetDays); i++ {
+		if strings.IndexByte(weekOrder, course.MeetDays[i]) >= 0 {
+			meetings = append(meetings, Meeting{Course: course, Day: course.MeetDays[i], Start: start, End: end})
+		}
+	}
+	return meetings
+}
+
+// RoomIndex answers occupancy questions about the rooms used in the schedule.
+type RoomIndex struct {
+	meetings map[string][]Meeting // Keyed by room name, e.g. "LS G12"
+}
+
+// roomName normalizes a building and room into the key used by RoomIndex.
+func roomName(building, room string) string {
+	return strings.ToUpper(strings.TrimSpace(building) + " " + strings.TrimSpace(room))
+}
+
+// NewRoomIndex builds the index from schedule rows. Online and TBA sections are skipped.
+func NewRoomIndex(courses []Course) *RoomIndex {
+	index := &RoomIndex{meetings: make(map[string][]Meeting)}
+	for _, course := range courses {
+		building := strings.ToUpper(course.Building)
+		if building == "" || course.Room == "" || building == "ONL" || building == "TBA" {
+			continue
+		}
+		name := roomName(course.Building, course.Room)
+		index.meetings[name] = append(index.meetings[name], courseMeetings(course)...)
+	}
+	for name := range index.meetings {
+		meetings := index.meetings[name]
+		sort.Slice(meetings, func(i, j int) bool {
+			if meetings[i].Day != meetings[j].Day {
+				return strings.IndexByte(weekOrder, meetings[i].Day) < strings.IndexByte(weekOrder, meetings[j].Day)
+			}
+			return meetings[i].Start < meetings[j].Start
+		})
+	}
+	return index
+}
+
+// Rooms lists the rooms in a building, or every room if building is empty.
+func (index *RoomIndex) Rooms(building string) []string {
+	prefix := strings.ToUpper(strings.TrimSpace(building)) + " "
+	var rooms []string
+	for name := range index.meetings {
+		if building == "" || strings.HasPrefix(name, prefix) {
+			rooms = append(rooms, name)
+		}
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// HasRoom reports whether the room appears in the schedule.
+func (index *RoomIndex) HasRoom(room string) bool {
+	_, ok := index.meetings[normalizeRoom(room)]
+	return ok
+}
+
+// normalizeRoom accepts "LS G12", "ls g12" or "LS-G12".
+func normalizeRoom(room string) string {
+	building, number, found := strings.Cut(strings.TrimSpace(strings.ReplaceAll(room, "-", " ")), " ")
+	if !found {
+		return strings.ToUpper(room)
+	}
+	return roomName(building, number)
+}
+
+// Busy returns the meetings held in the room on the given day, earliest first.
+func (index *RoomIndex) Busy(room string, day byte) []Meeting {
+	var busy []Meeting
+	for _, meeting := range index.meetings[normalizeRoom(room)] {
+		if meeting.Day == day {
+			busy = append(busy, meeting)
+		}
+	}
+	return busy
+}
+
+// IsFree reports whether the room is free on day between start and end (minutes after
+// midnight), returning the conflicting meetings when it is not.
+func (index *RoomIndex) IsFree(room string, day byte, start, end int) (bool, []Meeting) {
+	var conflicts []Meeting
+	for _, meeting := range index.Busy(room, day) {
+		if meeting.Overlaps(start, end) {
+			conflicts = append(conflicts, meeting)
+		}
+	}
+	return len(conflicts) == 0, conflicts
+}
+
+// FindFreeRooms lists the rooms in a building (or every building if empty) with no
+// meetings overlapping the window on the given day.
+func (index *RoomIndex) FindFreeRooms(building string, day byte, start, end int) []string {
+	var free []string
+	for _, room := range index.Rooms(building) {
+		if ok, _ := index.IsFree(room, day, start, end); ok {
+			free = append(free, room)
+		}
+	}
+	return free
+}
+
+// WeeklyGrid renders the room's week as a grid of hourly rows and day columns.
+func (index *RoomIndex) WeeklyGrid(room string) string {
+	meetings := index.meetings[normalizeRoom(room)]
+	if len(meetings) == 0 {
+		return fmt.Sprintf("%s has no scheduled meetings.", normalizeRoom(room))
+	}
+
+	days := "MTWRF"
+	first, last := 24*60, 0
+	for _, meeting := range meetings {
+		if strings.IndexByte(days, meeting.Day) < 0 {
+			days += string(meeting.Day)
+		}
+		first = min(first, meeting.Start)
+		last = max(last, meeting.End)
+	}
+
+	const cellWidth = 12
+	var grid strings.Builder
+	grid.WriteString(fmt.Sprintf("%s weekly schedule\n%-9s", normalizeRoom(room), ""))
+	for i := 0; i < len(days); i++ {
+		grid.WriteString(fmt.Sprintf("%-*s", cellWidth, dayNames[days[i]]))
+	}
+	grid.WriteString("\n")
+
+	for hour := first / 60; hour*60 < last; hour++ {
+		grid.WriteString(fmt.Sprintf("%-9s", formatClock(hour*60)))
+		for i := 0; i < len(days); i++ {
+			cell := ""
+			for _, meeting := range meetings {
+				if meeting.Day == days[i] && meeting.Overlaps(hour*60, hour*60+60) {
+					cell = meeting.Course.Subject + " " + meeting.Course.CourseNumber
+					break
+				}
+			}
+			grid.WriteString(fmt.Sprintf("%-*s", cellWidth, cell))
+		}
+		grid.WriteString("\n")
+	}
+	return strings.TrimRight(grid.String(), "\n")
+}
+
+// dayNames maps schedule day codes to names.
+var dayNames = map[byte]string{
+	'M': "Monday", 'T': "Tuesday", 'W': "Wednesday", 'R': "Thursday", 'F': "Friday", 'S': "Saturday", 'U': "Sunday",
+}
+
+// parseDay accepts a schedule day code (M, T, W, R, F, S, U) or a day name or
+// abbreviation such as "tue" or "Thursday".
+func parseDay(input string) (byte, bool) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if len(input) == 1 {
+		code := strings.ToUpper(input)[0]
+		_, ok := dayNames[code]
+		return code, ok
+	}
+	if len(input) < 3 {
+		return 0, false
+	}
+	for code, name := range dayNames {
+		if strings.HasPrefix(strings.ToLower(name), input) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// parseClock parses a schedule time such as "0930" or "1645" into minutes after midnight.
+func parseClock(value string) (int, bool) {
+	if len(value) != 4 {
+		return 0, false
+	}
+	hhmm, err := strconv.Atoi(value)
+	if err != nil || hhmm/100 > 23 || hhmm%100 > 59 {
+		return 0, false
+	}
+	return hhmm/100*60 + hhmm%100, true
+}
+
+// parseTimeOfDay accepts times like "2pm", "2:30 PM", "14:00", "1400" or "noon" and
+// returns minutes after midnight.
+func parseTimeOfDay(input string) (int, bool) {
+	input = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(input), " ", ""))
+	switch input {
+	case "noon":
+		return 12 * 60, true
+	case "midnight":
+		return 0, true
+	}
+
+	suffix := ""
+	if strings.HasSuffix(input, "am") || strings.HasSuffix(input, "pm") {
+		suffix = input[len(input)-2:]
+		input = input[:len(input)-2]
+	}
+
+	var hour, minute int
+	var err error
+	if h, m, found := strings.Cut(input, ":"); found {
+		if hour, err = strconv.Atoi(h); err != nil {
+			return 0, false
+		}
+		if minute, err = strconv.Atoi(m); err != nil {
+			return 0, false
+		}
+	} else if len(input) >= 3 {
+		value, err := strconv.Atoi(input)
+		if err != nil {
+			return 0, false
+		}
+		hour, minute = value/100, value%100
+	} else if hour, err = strconv.Atoi(input); err != nil {
+		return 0, false
+	}
+
+	switch {
+	case suffix == "" && hour <= 23:
+	case suffix != "" && hour >= 1 && hour <= 12:
+		hour %= 12
+		if suffix == "pm" {
+			hour += 12
+		}
+	default:
+		return 0, false
+	}
+	if minute < 0 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// formatClock renders minutes after midnight in 12-hour format, e.g. "2:30 PM".
+func formatClock(minutes int) string {
+	hour, minute := minutes/60, minutes%60
+	suffix := "AM"
+	if hour >= 12 {
+		suffix = "PM"
+	}
+	if hour%12 == 0 {
+		hour = 12
+	} else {
+		hour %= 12
+	}
+	return fmt.Sprintf("%d:%02d %s", hour, minute, suffix)
+}
+
+// parseTimeRange parses "2pm-4pm" or a single time. A single time is treated as a
+// one-minute window.
+func parseTimeRange(input string) (int, int, bool) {
+	if from, to, found := strings.Cut(input, "-"); found {
+		start, okStart := parseTimeOfDay(from)
+		end, okEnd := parseTimeOfDay(to)
+		return start, end, okStart && okEnd && start < end
+	}
+	start, ok := parseTimeOfDay(input)
+	return start, start + 1, ok
+}
+
+// RoomStatus answers "is <room> free on <day> at <time>?" or, without a time, lists the
+// room's meetings that day.
+func (index *RoomIndex) RoomStatus(room string, day byte, timeRange string) string {
+	room = normalizeRoom(room)
+	if !index.HasRoom(room) {
+		return fmt.Sprintf("%s is not used by any section in the %s schedule.", room, scheduleTerm)
+	}
+	if timeRange == "" {
+		busy := index.Busy(room, day)
+		if len(busy) == 0 {
+			return fmt.Sprintf("%s is free all %s.", room, dayNames[day])
+		}
+		lines := []string{fmt.Sprintf("%s on %s:", room, dayNames[day])}
+		for _, meeting := range busy {
+			lines = append(lines, "- "+meeting.String()+" "+meeting.Course.Title)
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	start, end, ok := parseTimeRange(timeRange)
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the time '%s'.", timeRange)
+	}
+	free, conflicts := index.IsFree(room, day, start, end)
+	if free {
+		return fmt.Sprintf("%s is free on %s at %s.", room, dayNames[day], timeRange)
+	}
+	lines := []string{fmt.Sprintf("%s is busy on %s at %s:", room, dayNames[day], timeRange)}
+	for _, meeting := range conflicts {
+		lines = append(lines, "- "+meeting.String()+" "+meeting.Course.Title)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleRoomSchedule runs the room_schedule tool.
+func (bot *ChatBot) handleRoomSchedule(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Room string `json:"room"`
+		Day  string `json:"day"`
+		Time string `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if args.Day == "" {
+		return bot.rooms.WeeklyGrid(args.Room), nil
+	}
+	day, ok := parseDay(args.Day)
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the day '%s'.", args.Day), nil
+	}
+	return bot.rooms.RoomStatus(args.Room, day, args.Time), nil
+}
+
+// handleFindFreeRoom runs the find_free_room tool.
+func (bot *ChatBot) handleFindFreeRoom(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Building string `json:"building"`
+		Day      string `json:"day"`
+		Start    string `json:"start"`
+		End      string `json:"end"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	day, ok := parseDay(args.Day)
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the day '%s'.", args.Day), nil
+	}
+	start, end, ok := parseTimeRange(args.Start + "-" + args.End)
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the time window %s-%s.", args.Start, args.End), nil
+	}
+	free := bot.rooms.FindFreeRooms(args.Building, day, start, end)
+	if len(free) == 0 {
+		return "No scheduled rooms are free in that window.", nil
+	}
+	return "Free rooms: " + strings.Join(free, ", "), nil
+}
+
+// roomCommand handles "/room <BLDG> <RM> [day [time]]" from the REPL.
+func roomCommand(index *RoomIndex, args string) string {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return "Usage: /room <building> <room> [day [time]]"
+	}
+	room := fields[0] + " " + fields[1]
+	if len(fields) == 2 {
+		return index.WeeklyGrid(room)
+	}
+	day, ok := parseDay(fields[2])
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the day '%s'.", fields[2])
+	}
+	return index.RoomStatus(room, day, strings.Join(fields[3:], ""))
+}
+
+// freeRoomCommand handles "/free [BLDG] <day> <start>-<end>" from the REPL.
+func freeRoomCommand(index *RoomIndex, args string) string {
+	fields := strings.Fields(args)
+	building := ""
+	if len(fields) == 3 {
+		building, fields = fields[0], fields[1:]
+	}
+	if len(fields) != 2 {
+		return "Usage: /free [building] <day> <start>-<end>"
+	}
+	day, ok := parseDay(fields[0])
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the day '%s'.", fields[0])
+	}
+	start, end, ok := parseTimeRange(fields[1])
+	if !ok {
+		return fmt.Sprintf("I couldn't understand the time window '%s'.", fields[1])
+	}
+	free := index.FindFreeRooms(building, day, start, end)
+	if len(free) == 0 {
+		return "No scheduled rooms are free in that window."
+	}
+	return "Free rooms: " + strings.Join(free, ", ")
+}
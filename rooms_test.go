@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testRoomIndex() *RoomIndex {
+	return NewRoomIndex([]Course{
+		{Subject: "CS", CourseNumber: "272", Section: "01", MeetDays: "TR", BeginTime: "1330", EndTime: "1510", Building: "LS", Room: "G12"},
+		{Subject: "CS", CourseNumber: "110", Section: "02", MeetDays: "MWF", BeginTime: "0915", EndTime: "1020", Building: "LS", Room: "G12"},
+		{Subject: "MATH", CourseNumber: "109", Section: "01", MeetDays: "M", BeginTime: "1400", EndTime: "1600", Building: "HR", Room: "148"},
+		{Subject: "CS", CourseNumber: "601", Section: "01", MeetDays: "T", BeginTime: "1600", EndTime: "1800", Building: "LS", Room: "103"},
+		{Subject: "ENGL", CourseNumber: "100", Section: "01", Building: "ONL", Room: "ONL"},
+	})
+}
+
+func TestRoomIsFree(t *testing.T) {
+	index := testRoomIndex()
+
+	free, conflicts := index.IsFree("ls g12", 'T', 14*60, 14*60+1)
+	if free || len(conflicts) != 1 || conflicts[0].Course.CourseNumber != "272" {
+		t.Errorf("Expected LS G12 to be busy with CS 272 Tuesday at 2pm, got free=%v %v", free, conflicts)
+	}
+	if free, _ := index.IsFree("LS G12", 'T', 15*60+10, 16*60); !free {
+		t.Error("Expected LS G12 to be free Tuesday right after CS 272 ends")
+	}
+
+	busy := index.Busy("HR 148", 'M')
+	if len(busy) != 1 || busy[0].String() != "2:00 PM-4:00 PM MATH 109-01" {
+		t.Errorf("Expected MATH 109 in HR 148 on Mondays, got %v", busy)
+	}
+	if index.HasRoom("ONL ONL") {
+		t.Error("Expected online sections to be left out of the room index")
+	}
+}
+
+func TestFindFreeRooms(t *testing.T) {
+	index := testRoomIndex()
+
+	if free := index.FindFreeRooms("LS", 'T', 14*60, 17*60); len(free) != 0 {
+		t.Errorf("Expected no free LS rooms Tuesday 2pm-5pm, got %v", free)
+	}
+	if free := index.FindFreeRooms("LS", 'T', 10*60, 12*60); !reflect.DeepEqual(free, []string{"LS 103", "LS G12"}) {
+		t.Errorf("Expected both LS rooms free Tuesday morning, got %v", free)
+	}
+	if !strings.Contains(freeRoomCommand(index, "HR monday 9am-11am"), "HR 148") {
+		t.Error("Expected the free command to find HR 148 on Monday morning")
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := map[string]int{"2pm": 14 * 60, "2:30 PM": 14*60 + 30, "12am": 0, "noon": 12 * 60, "1645": 16*60 + 45, "9": 9 * 60}
+	for input, want := range tests {
+		if got, ok := parseTimeOfDay(input); !ok || got != want {
+			t.Errorf("parseTimeOfDay(%q) = %d, %v; want %d", input, got, ok, want)
+		}
+	}
+	if _, ok := parseTimeOfDay("13pm"); ok {
+		t.Error("Expected 13pm to be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchResult is a single page returned by a SearchProvider.
+type SearchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchProvider finds real web pages for a query.
+type SearchProvider interface {
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
+// HTTPSearchProvider queries a configurable HTTP search endpoint. The endpoint is called
+// as GET <endpoint>?q=<query>&limit=<n> and must answer with
+// {"results": [{"title": "...", "url": "...", "snippet": "..."}]}.
+type HTTPSearchProvider struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+// NewHTTPSearchProvider creates a provider for the given endpoint. The API key, if set,
+// is sent as a bearer token.
+func NewHTTPSearchProvider(endpoint, apiKey string) *HTTPSearchProvider {
+	return &HTTPSearchProvider{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Search calls the endpoint and decodes its results. The request is abandoned when ctx
+// is done.
+func (p *HTTPSearchProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	searchURL, err := url.Parse(p.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search endpoint %q: %w", p.endpoint, err)
+	}
+	params := searchURL.Query()
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+	searchURL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search endpoint returned %s", resp.Status)
+	}
+
+	var body struct {
+		Results []SearchResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode search results: %w", err)
+	}
+	if len(body.Results) > limit {
+		body.Results = body.Results[:limit]
+	}
+	return body.Results, nil
+}
+
+// SiteIndexProvider searches a crawled or static set of university pages on disk.
+type SiteIndexProvider struct {
+	pages []Page
+}
+
+// NewSiteIndexProvider loads the pages under dir. Pages without a known URL are left
+// out so that every result links somewhere real.
+func NewSiteIndexProvider(dir, baseURL string) (*SiteIndexProvider, error) {
+	pages, err := LoadPages(dir, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var linked []Page
+	for _, page := range pages {
+		if page.URL != "" {
+			linked = append(linked, page)
+		}
+	}
+	return &SiteIndexProvider{pages: linked}, nil
+}
+
+// Search ranks pages by how often the query words appear, counting title matches
+// more heavily than body matches.
+func (p *SiteIndexProvider) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	type scoredPage struct {
+		page  Page
+		score int
+	}
+	var scored []scoredPage
+	for _, page := range p.pages {
+		title := strings.ToLower(page.Title)
+		text := strings.ToLower(page.Text)
+		score := 0
+		for _, term := range terms {
+			score += 3*strings.Count(title, term) + strings.Count(text, term)
+		}
+		if score > 0 {
+			scored = append(scored, scoredPage{page, score})
+		}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+
+	var results []SearchResult
+	for _, s := range scored {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, SearchResult{
+			Title:   s.page.Title,
+			URL:     s.page.URL,
+			Snippet: snippet(s.page.Text, terms),
+		})
+	}
+	return results, nil
+}
+
+// stopWords are ignored when matching queries against pages.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "of": true, "to": true, "for": true,
+	"in": true, "on": true, "i": true, "can": true, "my": true, "where": true, "how": true,
+	"what": true, "is": true, "do": true,
+}
+
+// searchTerms lowercases the query and drops punctuation and stop words.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if !stopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// snippet returns a short excerpt of text around the first matching term. It counts in
+// runes, as lowercasing can change the byte length of text but not its rune count.
+func snippet(text string, terms []string) string {
+	const width = 160
+	lower := strings.ToLower(text)
+	runes := []rune(text)
+	start := 0
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 {
+			start = max(0, utf8.RuneCountInString(lower[:i])-width/4)
+			break
+		}
+	}
+	end := min(len(runes), start+width)
+	excerpt := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if end < len(runes) {
+		excerpt += "..."
+	}
+	return excerpt
+}
+
+// formatSearchResults renders results as a list of links for the user.
+func formatSearchResults(results []SearchResult) string {
+	var out strings.Builder
+	out.WriteString("Here are some pages that may help:\n")
+	for _, result := range results {
+		out.WriteString(fmt.Sprintf("- %s: %s\n", result.Title, result.URL))
+	}
+	return out.String()
+}
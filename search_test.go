@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// newStandInSearchServer starts a search endpoint that answers every query with the
+// given results, so HTTPSearchProvider can be tested offline.
+func newStandInSearchServer(t *testing.T, results []SearchResult) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") == "" {
+			http.Error(w, "missing query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPSearchProvider(t *testing.T) {
+	server := newStandInSearchServer(t, []SearchResult{
+		{Title: "Registration", URL: "https://www.usfca.edu/registrar/registration"},
+		{Title: "Class Schedule", URL: "https://www.usfca.edu/registrar/class-schedule"},
+	})
+
+	provider := NewHTTPSearchProvider(server.URL, "")
+	results, err := provider.Search(context.Background(), "register for classes", 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].URL != "https://www.usfca.edu/registrar/registration" {
+		t.Errorf("Expected the registration page, got %v", results)
+	}
+}
+
+func TestSiteIndexProvider(t *testing.T) {
+	dir := t.TempDir()
+	pages := map[string]string{
+		"registration.html": `<html><head><title>Registration</title>
+<link rel="canonical" href="https://www.usfca.edu/registrar/registration"></head>
+<body><p>Register for classes in the student portal.</p></body></html>`,
+		"cs.md":        "---\ntitle: Computer Science\nurl: https://www.usfca.edu/arts-sciences/computer-science\n---\nMajors and minors in computer science.",
+		"unlinked.txt": "Register for parking permits.",
+	}
+	for name, content := range pages {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider, err := NewSiteIndexProvider(dir, "")
+	if err != nil {
+		t.Fatalf("NewSiteIndexProvider failed: %v", err)
+	}
+
+	results, err := provider.Search(context.Background(), "where can I register for classes", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Title != "Registration" {
+		t.Fatalf("Expected only the linked registration page, got %v", results)
+	}
+	if !strings.Contains(results[0].Snippet, "student portal") {
+		t.Errorf("Expected snippet from the page body, got '%s'", results[0].Snippet)
+	}
+}
+
+func TestSnippetMultibyte(t *testing.T) {
+	// "İ" is two bytes and lowercases to the one-byte "i", so byte offsets in the
+	// lowercased text fall elsewhere in the original; the excerpt starts 40 runes before
+	// the match
+	text := "x" + strings.Repeat("İ", 41) + " Register in the student portal. " + strings.Repeat("Über ", 40)
+	excerpt := snippet(text, []string{"portal"})
+	if !utf8.ValidString(excerpt) || !strings.HasPrefix(excerpt, strings.Repeat("İ", 15)+" Register") || !strings.HasSuffix(excerpt, "...") {
+		t.Errorf("Expected a valid excerpt around the match, got %q", excerpt)
+	}
+}
+
+func TestWebSearchAnswer(t *testing.T) {
+	server := newStandInSearchServer(t, []SearchResult{
+		{Title: "Registration", URL: "https://www.usfca.edu/registrar/registration"},
+	})
+
+	chatbot := NewChatBot(nil, &MetadataExtractor{}, nil, nil, nil)
+	chatbot.SetSearchProvider(NewHTTPSearchProvider(server.URL, ""))
+
+	answer, err := chatbot.AnswerQuestion(context.Background(), "Take me to the web page where I can register for classes")
+	if err != nil {
+		t.Fatalf("AnswerQuestion failed: %v", err)
+	}
+	if !strings.Contains(answer, "https://www.usfca.edu/registrar/registration") {
+		t.Errorf("Expected a link from the search provider, got '%s'", answer)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// askRequest is the body of a POST /ask request. Requests naming the same session
+// continue one conversation; an empty session starts a new one, whose ID is returned.
+// Naming a session the server did not issue, or has since forgotten, fails with 404. NoCache, or a
+// "Cache-Control: no-cache" header, answers the question anew instead of reusing a
+// cached answer. Debug returns a trace of how the answer was found with it.
+type askRequest struct {
+	Question string `json:"question"`
+	Session  string `json:"session,omitempty"`
+	NoCache  bool   `json:"no_cache,omitempty"`
+	Debug    bool   `json:"debug,omitempty"`
+}
+
+// askResponse is returned by POST /ask and by "ask --format json": the answer text and
+// the rest of the typed Answer.
+type askResponse struct {
+	Session    string         `json:"session,omitempty"`
+	Question   string         `json:"question"`
+	Answer     string         `json:"answer"`
+	Sections   []Course       `json:"sections"`
+	FollowUps  []string       `json:"follow_ups"`
+	Confidence float64        `json:"confidence"`
+	Intent     string         `json:"intent"`
+	Debug      *AnswerDetails `json:"debug,omitempty"` // Only when asked for
+}
+
+func newAskResponse(session, question string, answer *Answer, details *AnswerDetails) askResponse {
+	return askResponse{
+		Session:    session,
+		Question:   question,
+		Answer:     answer.Text,
+		Sections:   answer.Sections,
+		FollowUps:  answer.FollowUps,
+		Confidence: answer.Confidence,
+		Intent:     answer.Intent,
+		Debug:      details,
+	}
+}
+
+// server answers questions over HTTP, keeping one conversation per session so that
+// many users can ask questions at the same time.
+type server struct {
+	sessions *SessionManager
+}
+
+// newServer returns the HTTP handler for serve mode.
+func newServer(sessions *SessionManager) http.Handler {
+	s := &server{sessions: sessions}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ask", s.handleAsk)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleDeleteSession)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("GET /stats", s.handleStats)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+// handleHealth reports whether questions are answered with the vector store or, while it
+// is unavailable, from the in-process course data.
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if degraded := s.sessions.bot.Degraded(); degraded != nil {
+		fmt.Fprintf(w, "degraded: %v\n", degraded)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// statsResponse is returned by GET /stats. Usage per session is left out, as session
+// IDs are all that keeps one user out of another's conversation; a caller can ask for
+// its own with ?session=ID.
+type statsResponse struct {
+	UsageStats
+	Session *Usage `json:"session,omitempty"`
+}
+
+// handleStats reports token usage and estimated cost per day, feature and model, and
+// for the caller's session if it names one.
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
+	usage := s.sessions.bot.Usage()
+	response := statsResponse{UsageStats: usage.Stats()}
+	response.Sessions = nil
+	if id := r.URL.Query().Get("session"); id != "" {
+		session := usage.Session(id)
+		response.Session = &session
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, response)
+}
+
+// handleMetrics exposes the recorded metrics, cache use and live sessions in the
+// Prometheus text format. Hit rates are computed from the hit and miss counters.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.write(w)
+	writeMetric(w, "catalog_sessions", "Conversations currently kept.", "gauge", float64(s.sessions.Len()))
+
+	bot := s.sessions.bot
+	if answers := bot.AnswerCache(); answers != nil {
+		stats := answers.Stats()
+		writeMetric(w, "catalog_answer_cache_hits_total", "Questions answered from the answer cache.", "counter", float64(stats.Hits))
+		writeMetric(w, "catalog_answer_cache_misses_total", "Cacheable questions not found in the answer cache.", "counter", float64(stats.Misses))
+		writeMetric(w, "catalog_answer_cache_entries", "Answers in the answer cache.", "gauge", float64(stats.Entries))
+	}
+	if embeddings := bot.EmbeddingCache(); embeddings != nil {
+		stats := embeddings.Stats()
+		writeMetric(w, "catalog_embedding_cache_hits_total", "Texts whose embedding was found in the cache.", "counter", float64(stats.Hits))
+		writeMetric(w, "catalog_embedding_cache_misses_total", "Texts that had to be embedded.", "counter", float64(stats.Misses))
+	}
+	writeMetric(w, "catalog_degraded", "1 while questions are answered without the vector store.", "gauge", boolGauge(bot.Degraded() != nil))
+}
+
+// boolGauge is 1 for true and 0 for false.
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleAsk answers the question in the request body.
+func (s *server) handleAsk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req askRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Question) == "" {
+		http.Error(w, `expected {"question": "..."}`, http.StatusBadRequest)
+		return
+	}
+
+	// Logs and traces of the answer carry the caller's request ID, or a new one.
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	w.Header().Set("X-Request-ID", requestID)
+	ctx := WithRequestID(r.Context(), requestID)
+	if req.NoCache || strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		ctx = WithoutAnswerCache(ctx)
+	}
+	var details *AnswerDetails
+	if req.Debug {
+		ctx, details = WithAnswerDetails(ctx)
+	}
+	session, answer, err := s.sessions.AnswerStructured(ctx, req.Session, req.Question)
+	if r.Context().Err() != nil {
+		// The client went away, so there is no one to answer.
+		return
+	}
+	if errors.Is(err, ErrUnknownSession) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrBudgetExceeded) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, newAskResponse(session, req.Question, answer, details))
+}
+
+// handleDeleteSession forgets a conversation.
+func (s *server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	s.sessions.Delete(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
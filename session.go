@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Session is one user's conversation. The ChatBot holds everything shared between
+// users; a Session holds only the messages of its conversation and is locked while a
+// question is answered, so the turns of one conversation never interleave.
+type Session struct {
+	ID       string
+	mu       sync.Mutex
+	messages []openai.ChatCompletionMessage
+	lastUsed time.Time // Guarded by the SessionManager's lock
+}
+
+// NewSession starts a conversation with just the system prompt. The system prompt is
+// rendered from its template afresh for each question.
+func NewSession(id string) *Session {
+	session := &Session{ID: id}
+	session.Reset()
+	return session
+}
+
+// Reset forgets everything but the system prompt.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem},
+	}
+}
+
+// Messages returns a copy of the conversation so far.
+func (s *Session) Messages() []openai.ChatCompletionMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]openai.ChatCompletionMessage(nil), s.messages...)
+}
+
+// add appends a message. The caller holds s.mu.
+func (s *Session) add(message openai.ChatCompletionMessage) {
+	s.messages = append(s.messages, message)
+}
+
+// reply records a canned assistant answer in the conversation and returns it.
+func (s *Session) reply(answer string) string {
+	s.add(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer})
+	return answer
+}
+
+// usedToolsSince reports whether a tool was called after the first i messages. The
+// caller holds s.mu.
+func (s *Session) usedToolsSince(i int) bool {
+	for _, message := range s.messages[i:] {
+		if message.Role == openai.ChatMessageRoleTool {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHistory reports whether the conversation holds an earlier exchange besides the
+// system prompt and the question currently being answered.
+func (s *Session) hasHistory() bool {
+	return len(s.messages) > 2
+}
+
+// ErrUnknownSession is returned for a session ID the manager did not issue, or one whose
+// session has been deleted or evicted.
+var ErrUnknownSession = errors.New("unknown session")
+
+// SessionManager keeps one Session per user of a shared ChatBot and forgets sessions
+// that have been idle for longer than idleTimeout.
+type SessionManager struct {
+	bot         *ChatBot
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewSessionManager creates a manager answering with bot. A zero idleTimeout keeps
+// sessions until they are deleted.
+func NewSessionManager(bot *ChatBot, idleTimeout time.Duration) *SessionManager {
+	return &SessionManager{bot: bot, idleTimeout: idleTimeout, sessions: make(map[string]*Session)}
+}
+
+// Session returns the session with the given ID. An empty ID starts a session with a
+// fresh random ID; any other ID must be one the manager issued and still keeps, so
+// clients cannot choose the ID, and with it the budget, of a conversation.
+func (m *SessionManager) Session(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == "" {
+		id = newSessionID()
+		m.sessions[id] = NewSession(id)
+	}
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrUnknownSession
+	}
+	session.lastUsed = m.bot.clock.Now()
+	return session, nil
+}
+
+// Answer answers a question in the session with the given ID and returns the ID used.
+func (m *SessionManager) Answer(ctx context.Context, id, question string) (string, string, error) {
+	session, err := m.Session(id)
+	if err != nil {
+		return "", "", err
+	}
+	answer, err := m.bot.Answer(ctx, session, question)
+	m.touch(session)
+	return session.ID, answer, err
+}
+
+// AnswerStructured answers a question in the session with the given ID with a typed
+// Answer and returns the ID used.
+func (m *SessionManager) AnswerStructured(ctx context.Context, id, question string) (string, *Answer, error) {
+	session, err := m.Session(id)
+	if err != nil {
+		return "", nil, err
+	}
+	answer, err := m.bot.AnswerStructured(ctx, session, question)
+	m.touch(session)
+	return session.ID, answer, err
+}
+
+// Delete forgets a session. Its usage is kept, so deleting a session and starting it
+// again does not reset its budget.
+func (m *SessionManager) Delete(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
+
+// Len returns the number of live sessions.
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// EvictIdle forgets sessions last used more than the idle timeout before now and
+// returns how many were evicted.
+func (m *SessionManager) EvictIdle(now time.Time) int {
+	if m.idleTimeout <= 0 {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	evicted := 0
+	for id, session := range m.sessions {
+		if now.Sub(session.lastUsed) > m.idleTimeout {
+			delete(m.sessions, id)
+			m.bot.usage.ForgetSession(id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Run evicts idle sessions periodically until ctx is done.
+func (m *SessionManager) Run(ctx context.Context) {
+	if m.idleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(min(m.idleTimeout/2, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.EvictIdle(m.bot.clock.Now())
+		}
+	}
+}
+
+// touch marks a session as used now.
+func (m *SessionManager) touch(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.lastUsed = m.bot.clock.Now()
+}
+
+// newSessionID returns a random session ID.
+func newSessionID() string {
+	return randomHex(16)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// echoLLM is a stand-in model that answers with the last question it was asked. If
+// calls is not nil, it counts the completions requested.
+func echoLLM(t *testing.T, calls *atomic.Int32) *LLMClient {
+	return newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls != nil {
+			calls.Add(1)
+		}
+		req, err := decodeCompletionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var question string
+		for _, message := range req.Messages {
+			if message.Role == openai.ChatMessageRoleUser {
+				question = message.Content
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "answer to " + question},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	})
+}
+
+// startSession starts a session in sessions and returns its ID.
+func startSession(t *testing.T, sessions *SessionManager) string {
+	t.Helper()
+	session, err := sessions.Session("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.ID
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	chatbot := NewChatBot(echoLLM(t, nil), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	sessions := NewSessionManager(chatbot, time.Hour)
+
+	const users, questions = 8, 10
+	ids := make([]string, users)
+	for u := range ids {
+		ids[u] = startSession(t, sessions)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, users*questions+questions)
+	for u := 0; u < users; u++ {
+		for q := 0; q < questions; q++ {
+			wg.Add(1)
+			go func(u, q int) {
+				defer wg.Done()
+				id := ids[u]
+				question := fmt.Sprintf("Who teaches CS 272? (%s, %d)", id, q)
+				_, answer, err := sessions.Answer(context.Background(), id, question)
+				if err != nil {
+					errs <- err
+				} else if answer != "answer to "+question {
+					errs <- fmt.Errorf("%s got %q for %q", id, answer, question)
+				}
+			}(u, q)
+		}
+	}
+	// The chatbot's own conversation is used at the same time.
+	for q := 0; q < questions; q++ {
+		wg.Add(1)
+		go func(q int) {
+			defer wg.Done()
+			if _, err := chatbot.AnswerQuestion(context.Background(), fmt.Sprintf("Who teaches CS 272? (default, %d)", q)); err != nil {
+				errs <- err
+			}
+		}(q)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if sessions.Len() != users {
+		t.Errorf("Expected %d sessions, got %d", users, sessions.Len())
+	}
+	for _, id := range ids {
+		session, err := sessions.Session(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages := session.Messages()
+		// System prompt, then a question and an answer per turn
+		if len(messages) != 1+2*questions {
+			t.Errorf("Expected %d messages in %s, got %d", 1+2*questions, id, len(messages))
+		}
+		for _, message := range messages {
+			if message.Role == openai.ChatMessageRoleUser && !strings.Contains(message.Content, id+",") {
+				t.Errorf("Session %s holds another user's question %q", id, message.Content)
+			}
+		}
+	}
+}
+
+func TestEvictIdleSessions(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	chatbot := NewChatBot(nil, &MetadataExtractor{}, nil, nil, nil)
+	chatbot.SetClock(fixedClock(now))
+	sessions := NewSessionManager(chatbot, 30*time.Minute)
+
+	first, second := startSession(t, sessions), startSession(t, sessions)
+	if first == "" || first == second {
+		t.Fatalf("Expected distinct generated IDs, got %q and %q", first, second)
+	}
+
+	chatbot.SetClock(fixedClock(now.Add(20 * time.Minute)))
+	if _, err := sessions.Session(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if evicted := sessions.EvictIdle(now.Add(40 * time.Minute)); evicted != 1 {
+		t.Errorf("Expected only the idle session to be evicted, evicted %d", evicted)
+	}
+	if sessions.Len() != 1 {
+		t.Errorf("Expected one live session, got %d", sessions.Len())
+	}
+	if _, err := sessions.Session(first); !errors.Is(err, ErrUnknownSession) {
+		t.Errorf("Expected an evicted session to be gone, got %v", err)
+	}
+}
+
+func TestUnknownSession(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "272", CRN: "1", Title: "Software Development", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	var calls atomic.Int32
+	chatbot := NewChatBot(echoLLM(t, &calls), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	sessions := NewSessionManager(chatbot, time.Hour)
+	handler := newServer(sessions)
+
+	// A session the server did not issue is not started under the client's ID
+	recorder := postQuestion(handler, `{"question": "Who teaches CS 272?", "session": "alice"}`, "")
+	if recorder.Code != http.StatusNotFound || sessions.Len() != 0 || calls.Load() != 0 {
+		t.Errorf("Expected 404 for an unknown session, got %d with %d sessions", recorder.Code, sessions.Len())
+	}
+
+	// The ID issued for a new conversation continues it
+	recorder = postQuestion(handler, `{"question": "Who teaches CS 272?"}`, "")
+	var response askResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || len(response.Session) != 32 {
+		t.Fatalf("Expected a generated session ID, got %+v, %v", response, err)
+	}
+	recorder = postQuestion(handler, `{"question": "And CS 110?", "session": "`+response.Session+`"}`, "")
+	if recorder.Code != http.StatusOK || sessions.Len() != 1 {
+		t.Errorf("Expected the issued session to continue, got %d with %d sessions", recorder.Code, sessions.Len())
+	}
+}
+
+func TestRetrievedContextIsPerTurn(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]openai.ChatCompletionMessage
+	llm := newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeCompletionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req.Messages)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Philip Peterson teaches it."},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	})
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+		{Subject: "MATH", CourseNumber: "109", Section: "02", CRN: "41002", Title: "Calculus I", InstructorFirstName: "Ada", InstructorLastName: "Lovelace"},
+	}
+	chatbot := NewChatBot(llm, &MetadataExtractor{courses: courses}, nil, nil, nil)
+	session := NewSession("alice")
+	for _, question := range []string{"Who teaches CS 110?", "Who teaches MATH 109?"} {
+		if _, err := chatbot.Answer(context.Background(), session, question); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	isContext := func(message openai.ChatCompletionMessage) bool {
+		return strings.HasPrefix(message.Content, "Based on the available information")
+	}
+	for i, messages := range requests {
+		contexts := 0
+		for j, message := range messages {
+			if isContext(message) {
+				contexts++
+				if message.Role != openai.ChatMessageRoleSystem || messages[j-1].Role != openai.ChatMessageRoleUser {
+					t.Errorf("Request %d: expected the context as a system message after the question, got %s after %s", i, message.Role, messages[j-1].Role)
+				}
+			}
+		}
+		if contexts != 1 {
+			t.Errorf("Request %d: expected only this turn's context, got %d contexts", i, contexts)
+		}
+	}
+	if last := requests[1]; strings.Contains(fmt.Sprint(last), `\"CRN\":\"41001\"`) {
+		t.Errorf("Expected the first turn's matches to be gone from the second request: %v", last)
+	}
+	messages := session.Messages()
+	if len(messages) != 5 {
+		t.Errorf("Expected the system prompt and two questions and answers, got %d messages", len(messages))
+	}
+	for _, message := range messages {
+		if isContext(message) {
+			t.Errorf("Expected no context in the conversation, got %q", message.Content)
+		}
+	}
+
+	// With summaries, a compact note of what was shown follows each question
+	retrieval := DefaultConfig().Retrieval
+	retrieval.KeepSummary = true
+	chatbot.SetRetrievalConfig(retrieval)
+	session = NewSession("bob")
+	if _, err := chatbot.Answer(context.Background(), session, "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+	messages = session.Messages()
+	if len(messages) != 4 || messages[2].Role != openai.ChatMessageRoleSystem {
+		t.Fatalf("Expected a summary between the question and the answer, got %v", messages)
+	}
+	if summary := messages[2].Content; !strings.Contains(summary, "CS 110-01 Introduction to Computer Science") || !strings.Contains(summary, "CRN 41001") || isContext(messages[2]) {
+		t.Errorf("Expected a compact summary of the matches, got %q", summary)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TableStyle controls how tables are fitted to and highlighted on the terminal.
+type TableStyle struct {
+	Width int  // Maximum line width; zero never truncates
+	Color bool // Highlight with ANSI colors
+}
+
+// Values of the --color flag.
+const (
+	colorAuto   = "auto"   // Color when writing to a terminal and $NO_COLOR is not set
+	colorAlways = "always" // Color even when piped
+	colorNever  = "never"
+)
+
+// defaultTerminalWidth is assumed for terminals whose size is unknown and $COLUMNS is not set.
+const defaultTerminalWidth = 100
+
+// terminalStyle returns the style for tables written to w: fitted to the terminal
+// width and colored as the --color flag asks if w is a terminal, and untruncated
+// otherwise. The width is the terminal's own, or $COLUMNS if it cannot be queried.
+func terminalStyle(w io.Writer, color string) TableStyle {
+	file, _ := w.(*os.File)
+	terminal := false
+	if file != nil {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			terminal = true
+		}
+	}
+	var style TableStyle
+	switch color {
+	case colorAlways:
+		style.Color = true
+	case colorAuto, "":
+		_, noColor := os.LookupEnv("NO_COLOR")
+		style.Color = terminal && !noColor
+	}
+	if terminal {
+		style.Width = defaultTerminalWidth
+		if columns, err := terminalWidth(int(file.Fd())); err == nil && columns > 0 {
+			style.Width = columns
+		} else if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+			style.Width = columns
+		}
+	}
+	return style
+}
+
+// ANSI escape sequences used to highlight tables.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiHeader = "\x1b[1;4m"  // Bold, underlined
+	ansiCourse = "\x1b[1;36m" // Bold cyan
+	ansiFaint  = "\x1b[2m"
+)
+
+// Columns of the course table.
+var courseColumns = []tableColumn{
+	{title: "COURSE"},
+	{title: "TITLE", minWidth: 12, shrink: 1},
+	{title: "DAYS"},
+	{title: "TIME"},
+	{title: "ROOM", minWidth: 6, shrink: 3},
+	{title: "INSTRUCTOR", minWidth: 10, shrink: 2},
+	{title: "ENROLLMENT", right: true},
+}
+
+// tableColumn describes a column of a table.
+type tableColumn struct {
+	title    string
+	right    bool // Right-aligned, for numbers
+	minWidth int  // Narrowest the column is truncated to
+	shrink   int  // Order in which columns are truncated to fit, from 1; zero never truncates
+}
+
+// notScheduled stands in for the days, time or room of sections without them.
+const notScheduled = "TBA"
+
+// courseCells returns a section's cells in courseColumns order.
+func courseCells(course Course) []string {
+	days := strings.TrimSpace(course.MeetDays)
+	if days == "" {
+		days = notScheduled
+	}
+	times := notScheduled
+	start, okStart := parseClock(course.BeginTime)
+	end, okEnd := parseClock(course.EndTime)
+	if okStart && okEnd {
+		times = formatClock(start) + "-" + formatClock(end)
+	}
+	room := strings.TrimSpace(course.Building + " " + course.Room)
+	if room == "" {
+		room = notScheduled
+	}
+	return []string{
+		fmt.Sprintf("%s %s-%s", course.Subject, course.CourseNumber, course.Section),
+		course.Title,
+		days,
+		times,
+		room,
+		instructorName(course),
+		strings.TrimSpace(course.ActualEnrollment),
+	}
+}
+
+// writeCourseTable writes sections as an aligned table, truncating the widest columns
+// with an ellipsis so lines fit style.Width.
+func writeCourseTable(w io.Writer, courses []Course, style TableStyle) error {
+	rows := make([][]string, len(courses))
+	for i, course := range courses {
+		rows[i] = courseCells(course)
+	}
+	widths := fitColumns(courseColumns, rows, style.Width)
+
+	var b strings.Builder
+	header := make([]string, len(courseColumns))
+	for i, column := range courseColumns {
+		header[i] = highlight(pad(column.title, widths[i], column.right), ansiHeader, style.Color)
+	}
+	b.WriteString(strings.TrimRight(strings.Join(header, "  "), " ") + "\n")
+	for _, row := range rows {
+		line := make([]string, len(row))
+		for i, cell := range row {
+			cell = pad(truncate(cell, widths[i]), widths[i], courseColumns[i].right)
+			switch {
+			case i == 0:
+				cell = highlight(cell, ansiCourse, style.Color)
+			case strings.TrimSpace(cell) == notScheduled:
+				cell = highlight(cell, ansiFaint, style.Color)
+			}
+			line[i] = cell
+		}
+		b.WriteString(strings.TrimRight(strings.Join(line, "  "), " ") + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fitColumns returns the width of each column: as wide as its widest cell, then
+// narrowed in shrink order, no further than each column's minimum, until rows fit in
+// width. A zero width never narrows columns.
+func fitColumns(columns []tableColumn, rows [][]string, width int) []int {
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column.title)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	if width <= 0 {
+		return widths
+	}
+
+	total := 2 * (len(columns) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for order := 1; total > width; order++ {
+		shrunk := false
+		for i, column := range columns {
+			if column.shrink != order {
+				continue
+			}
+			shrunk = true
+			cut := min(total-width, max(widths[i]-column.minWidth, 0))
+			widths[i] -= cut
+			total -= cut
+		}
+		if !shrunk {
+			break
+		}
+	}
+	return widths
+}
+
+// truncate shortens s to width runes, ending it with an ellipsis if anything was cut.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string([]rune(s)[:width])
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+// pad pads s with spaces to width runes.
+func pad(s string, width int, right bool) string {
+	padding := strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+	if right {
+		return padding + s
+	}
+	return s + padding
+}
+
+// highlight wraps s in an ANSI color if color is set.
+func highlight(s, ansi string, color bool) string {
+	if !color {
+		return s
+	}
+	return ansi + s + ansiReset
+}
+
+// writeCourseCSV writes sections as CSV, with the course table's columns and the CRN.
+func writeCourseCSV(w io.Writer, courses []Course) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Course", "CRN", "Title", "Days", "Time", "Room", "Instructor", "Enrollment"})
+	for _, course := range courses {
+		cells := courseCells(course)
+		out.Write(append([]string{cells[0], course.CRN}, cells[1:]...))
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCourseTable(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", Section: "01", CRN: "40630", Title: "Intro to Computer Science", MeetDays: "MW",
+			BeginTime: "1645", EndTime: "1825", Building: "HR", Room: "148", InstructorFirstName: "Julia", InstructorLastName: "Nolfo", ActualEnrollment: "30"},
+		{Subject: "CS", CourseNumber: "490", Section: "01", CRN: "41900", Title: "Independent Study", InstructorFirstName: "Ada", InstructorLastName: "Lovelace", ActualEnrollment: "2"},
+	}
+
+	var out bytes.Buffer
+	if err := writeCourseTable(&out, courses, TableStyle{}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := []string{
+		"COURSE     TITLE                      DAYS  TIME             ROOM    INSTRUCTOR    ENROLLMENT",
+		"CS 110-01  Intro to Computer Science  MW    4:45 PM-6:25 PM  HR 148  Julia Nolfo           30",
+		"CS 490-01  Independent Study          TBA   TBA              TBA     Ada Lovelace           2",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), out.String())
+	}
+
+	// Narrow terminals truncate the title first, then the instructor
+	out.Reset()
+	writeCourseTable(&out, courses, TableStyle{Width: 80})
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if n := utf8.RuneCountInString(line); n > 80 {
+			t.Errorf("Expected lines of at most 80 columns, got %d: %q", n, line)
+		}
+	}
+	if !strings.Contains(out.String(), "Intro to Co…") || !strings.Contains(out.String(), "Julia Nolfo") {
+		t.Errorf("Expected only the title to be truncated:\n%s", out.String())
+	}
+
+	out.Reset()
+	writeCourseTable(&out, courses, TableStyle{Color: true})
+	if !strings.Contains(out.String(), ansiCourse+"CS 110-01"+ansiReset) {
+		t.Errorf("Expected highlighted course codes, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := writeCourseCSV(&out, courses); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || strings.Join(records[1], "|") != "CS 110-01|40630|Intro to Computer Science|MW|4:45 PM-6:25 PM|HR 148|Julia Nolfo|30" {
+		t.Errorf("Unexpected CSV %v", records)
+	}
+}
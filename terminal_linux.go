@@ -0,0 +1,42 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// enableRawMode switches the terminal on fd to reading key by key without echo, and
+// returns a function restoring its previous mode. It fails if fd is not a terminal.
+// Output processing is left on, so "\n" still starts a new line.
+func enableRawMode(fd int) (func(), error) {
+	var saved syscall.Termios
+	if err := ioctlTermios(fd, syscall.TCGETS, &saved); err != nil {
+		return nil, err
+	}
+	raw := saved
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() { ioctlTermios(fd, syscall.TCSETS, &saved) }, nil
+}
+
+// terminalWidth returns the number of columns of the terminal on fd.
+func terminalWidth(fd int) (int, error) {
+	var size struct{ rows, cols, xpixel, ypixel uint16 }
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return 0, errno
+	}
+	return int(size.cols), nil
+}
+
+func ioctlTermios(fd int, request uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// enableRawMode is only supported on Linux; elsewhere lines are read without editing.
+func enableRawMode(fd int) (func(), error) {
+	return nil, errors.ErrUnsupported
+}
+
+// terminalWidth is only supported on Linux; elsewhere tables are fitted to $COLUMNS.
+func terminalWidth(fd int) (int, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -59,3 +59,144 @@ func WebSearchTool() openai.FunctionDefinition {
 		Parameters:  schema,
 	}
 }
+
+// CoursePrerequisitesTool defines a tool for looking up a course's catalog description and requirements.
+func CoursePrerequisitesTool() openai.FunctionDefinition {
+	schema := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"course": {
+				Type:        jsonschema.String,
+				Description: "The course code (e.g., CS 272).",
+			},
+		},
+		Required: []string{"course"},
+	}
+
+	return openai.FunctionDefinition{
+		Name:        "course_prerequisites",
+		Description: "Get a course's catalog description, units, prerequisites and corequisites, and its sections this term.",
+		Parameters:  schema,
+	}
+}
+
+// NextCoursesTool defines a tool for finding the courses unlocked by completed courses.
+func NextCoursesTool() openai.FunctionDefinition {
+	schema := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"completed": {
+				Type:        jsonschema.Array,
+				Items:       &jsonschema.Definition{Type: jsonschema.String},
+				Description: "Course codes the student has completed (e.g., [\"CS 112\"]).",
+			},
+		},
+		Required: []string{"completed"},
+	}
+
+	return openai.FunctionDefinition{
+		Name:        "courses_after",
+		Description: "List the courses a student can take after completing the given courses.",
+		Parameters:  schema,
+	}
+}
+
+// PrerequisitePathTool defines a tool for finding the sequence of courses leading to a course.
+func PrerequisitePathTool() openai.FunctionDefinition {
+	schema := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"course": {
+				Type:        jsonschema.String,
+				Description: "The target course code (e.g., CS 315).",
+			},
+		},
+		Required: []string{"course"},
+	}
+
+	return openai.FunctionDefinition{
+		Name:        "prerequisite_path",
+		Description: "List every course needed before a target course, in the order they can be taken.",
+		Parameters:  schema,
+	}
+}
+
+// LookupInstructorTool defines a tool for looking up an instructor's profile.
+func LookupInstructorTool() openai.FunctionDefinition {
+	schema := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"name": {
+				Type:        jsonschema.String,
+				Description: "The instructor's full name, alias, or a unique first or last name (e.g., Greg Benson).",
+			},
+		},
+		Required: []string{"name"},
+	}
+
+	return openai.FunctionDefinition{
+		Name:        "lookup_instructor",
+		Description: "Get an instructor's email, departments, courses, total enrollment, meeting days and buildings.",
+		Parameters:  schema,
+	}
+}
+
+// RoomScheduleTool defines a tool for checking what is scheduled in a room.
+func RoomScheduleTool() openai.FunctionDefinition {
+	schema := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"room": {
+				Type:        jsonschema.String,
+				Description: "The building code and room number (e.g., LS G12, HR 148).",
+			},
+			"day": {
+				Type:        jsonschema.String,
+				Description: "Day of the week (e.g., Tuesday). Omit to get the whole week.",
+			},
+			"time": {
+				Type:        jsonschema.String,
+				Description: "A time or window to check (e.g., 2pm or 2pm-4pm). Omit to list the whole day.",
+			},
+		},
+		Required: []string{"room"},
+	}
+
+	return openai.FunctionDefinition{
+		Name:        "room_schedule",
+		Description: "Show a room's weekly schedule, its meetings on a day, or whether it is free at a time.",
+		Parameters:  schema,
+	}
+}
+
+// FindFreeRoomTool defines a tool for finding rooms with no classes in a time window.
+func FindFreeRoomTool() openai.FunctionDefinition {
+	schema := jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"building": {
+				Type:        jsonschema.String,
+				Description: "The building code (e.g., LS, HR). Omit to search every building.",
+			},
+			"day": {
+				Type:        jsonschema.String,
+				Description: "Day of the week (e.g., Monday).",
+			},
+			"start": {
+				Type:        jsonschema.String,
+				Description: "Start of the window (e.g., 2pm).",
+			},
+			"end": {
+				Type:        jsonschema.String,
+				Description: "End of the window (e.g., 4pm).",
+			},
+		},
+		Required: []string{"day", "start", "end"},
+	}
+
+	return openai.FunctionDefinition{
+		Name:        "find_free_room",
+		Description: "Find rooms with no scheduled classes on a day during a time window.",
+		Parameters:  schema,
+	}
+}
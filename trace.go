@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer appends the spans of each answered question to a file in the OpenTelemetry
+// protocol's JSON encoding, one export request per line, so the file can be loaded by
+// an OpenTelemetry collector or trace viewer to see where each answer's time went. The
+// trace ID is the request ID when that is a valid trace ID, and derived from it
+// otherwise.
+type Tracer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+// OpenTracer appends traces to the file at path.
+func OpenTracer(path string) (*Tracer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open trace file: %w", err)
+	}
+	return &Tracer{w: file, file: file}, nil
+}
+
+// Close closes the trace file.
+func (t *Tracer) Close() error {
+	if t == nil || t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// trace collects the spans of one request until its root span ends.
+type trace struct {
+	tracer *Tracer
+	id     string
+
+	mu    sync.Mutex
+	spans []*span
+}
+
+// span times one stage of answering a question. A nil span records nothing, so stages
+// are instrumented the same way whether or not tracing is enabled.
+type span struct {
+	trace  *trace
+	id     string
+	parent string
+	name   string
+	start  time.Time
+	end    time.Time
+	attrs  []slog.Attr
+	err    error
+}
+
+// spanKey carries the current span in a context.
+type spanKey struct{}
+
+// startTrace starts the root span of the request in ctx, which must have a request ID.
+// It returns a nil span if tracer is nil.
+func startTrace(ctx context.Context, tracer *Tracer, name string) (context.Context, *span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	requestID := RequestID(ctx)
+	root := &span{trace: &trace{tracer: tracer, id: traceID(requestID)}, id: randomHex(8), name: name, start: time.Now()}
+	root.attrs = []slog.Attr{slog.String("request", requestID)}
+	return context.WithValue(ctx, spanKey{}, root), root
+}
+
+// traceID returns requestID if it is 32 hex digits, as OpenTelemetry requires, or
+// else a trace ID derived from it.
+func traceID(requestID string) string {
+	if _, err := hex.DecodeString(requestID); err == nil && len(requestID) == 32 {
+		return strings.ToLower(requestID)
+	}
+	sum := sha256.Sum256([]byte(requestID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// startSpan starts a child of the current span in ctx. It returns a nil span if ctx is
+// not being traced.
+func startSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *span) {
+	parent, _ := ctx.Value(spanKey{}).(*span)
+	if parent == nil {
+		return ctx, nil
+	}
+	child := &span{trace: parent.trace, id: randomHex(8), parent: parent.id, name: name, start: time.Now(), attrs: attrs}
+	return context.WithValue(ctx, spanKey{}, child), child
+}
+
+// SetAttributes records facts about the stage.
+func (s *span) SetAttributes(attrs ...slog.Attr) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes the stage, marking it failed if err is not nil. Ending the root span
+// writes the whole trace.
+func (s *span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	s.end = time.Now()
+	s.err = err
+	s.trace.spans = append(s.trace.spans, s)
+	spans := s.trace.spans
+	s.trace.mu.Unlock()
+
+	if s.parent == "" {
+		if err := s.trace.tracer.write(s.trace.id, spans); err != nil {
+			slog.Warn("Failed to write trace", "err", err)
+		}
+	}
+}
+
+// write appends one trace as an OTLP/JSON export request.
+func (t *Tracer) write(traceID string, spans []*span) error {
+	encoded := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parent,
+			Name:              s.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+		}
+		if s.err != nil {
+			encoded[i].Status = &otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+		}
+	}
+	request := otlpExport{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes([]slog.Attr{slog.String("service.name", "course-catalog")})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "course-catalog"}, Spans: encoded}},
+	}}}
+	line, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.w.Write(append(line, '\n'))
+	return err
+}
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest, limited to what is written.
+type (
+	otlpExport struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            *otlpStatus     `json:"status,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"` // 64-bit integers are strings in OTLP/JSON
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+// otlpAttributes converts log attributes to span attributes.
+func otlpAttributes(attrs []slog.Attr) []otlpAttribute {
+	converted := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		value := attr.Value.Resolve()
+		var v otlpValue
+		switch value.Kind() {
+		case slog.KindInt64:
+			s := strconv.FormatInt(value.Int64(), 10)
+			v.IntValue = &s
+		case slog.KindUint64:
+			s := strconv.FormatUint(value.Uint64(), 10)
+			v.IntValue = &s
+		case slog.KindFloat64:
+			f := value.Float64()
+			v.DoubleValue = &f
+		case slog.KindBool:
+			b := value.Bool()
+			v.BoolValue = &b
+		default:
+			s := value.String()
+			v.StringValue = &s
+		}
+		converted = append(converted, otlpAttribute{Key: attr.Key, Value: v})
+	}
+	return converted
+}
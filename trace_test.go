@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnswerTrace(t *testing.T) {
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	chatbot := NewChatBot(echoLLM(t, nil), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	var traces bytes.Buffer
+	chatbot.SetTracer(&Tracer{w: &traces})
+
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	logPath := filepath.Join(t.TempDir(), "catalog.log")
+	if err := setupLogging(LogConfig{Level: "debug", Format: logFormatJSON, File: logPath}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	const requestID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := WithRequestID(context.Background(), requestID)
+	if _, err := chatbot.Answer(ctx, NewSession("alice"), "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+
+	var export otlpExport
+	if err := json.Unmarshal(traces.Bytes(), &export); err != nil {
+		t.Fatalf("Expected one OTLP JSON line, got %q: %v", traces.String(), err)
+	}
+	spans := export.ResourceSpans[0].ScopeSpans[0].Spans
+	var root otlpSpan
+	names := make(map[string]bool)
+	for _, span := range spans {
+		if span.TraceID != requestID {
+			t.Errorf("Expected the request ID as trace ID, got %s", span.TraceID)
+		}
+		if span.ParentSpanID == "" {
+			root = span
+		}
+		names[span.Name] = true
+	}
+	if root.Name != "answer" {
+		t.Fatalf("Expected an answer root span, got %+v", root)
+	}
+	for _, stage := range []string{"resolve_aliases", "retrieve", "assemble_prompt", "complete"} {
+		if !names[stage] {
+			t.Errorf("Expected a %s span, got %v", stage, names)
+		}
+	}
+	for _, span := range spans {
+		if span.Name == "complete" && span.ParentSpanID != root.SpanID {
+			t.Errorf("Expected completion to be a child of the answer, got parent %s", span.ParentSpanID)
+		}
+	}
+
+	logs, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(logs)), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON log lines, got %q", line)
+		}
+		if record["request"] != requestID {
+			t.Errorf("Expected every log line to carry the request ID: %s", line)
+		}
+		stages++
+	}
+	if stages < 4 {
+		t.Errorf("Expected a log line per stage, got:\n%s", logs)
+	}
+}
+
+func TestServerRequestID(t *testing.T) {
+	chatbot := NewChatBot(echoLLM(t, nil), &MetadataExtractor{}, nil, nil, nil)
+	var traces bytes.Buffer
+	chatbot.SetTracer(&Tracer{w: &traces})
+	handler := newServer(NewSessionManager(chatbot, time.Hour))
+
+	recorder := postQuestion(handler, `{"question": "Who teaches CS 110?"}`, "caller-chosen-id")
+	if got := recorder.Header().Get("X-Request-ID"); got != "caller-chosen-id" {
+		t.Errorf("Expected the caller's request ID to be echoed, got %q", got)
+	}
+	if !strings.Contains(traces.String(), `"traceId":"`+traceID("caller-chosen-id")+`"`) || !strings.Contains(traces.String(), "caller-chosen-id") {
+		t.Errorf("Expected the trace to be derived from and record the caller's request ID:\n%s", traces.String())
+	}
+
+	recorder = postQuestion(handler, `{"question": "Who teaches CS 110?"}`, "")
+	if got := recorder.Header().Get("X-Request-ID"); len(got) != 32 {
+		t.Errorf("Expected a generated request ID, got %q", got)
+	}
+}
+
+// postQuestion sends a question to handler with the given X-Request-ID header, if any.
+func postQuestion(handler http.Handler, body, requestID string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/ask", strings.NewReader(body))
+	if requestID != "" {
+		request.Header.Set("X-Request-ID", requestID)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
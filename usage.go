@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/amikos-tech/chroma-go/types"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Features that use the models, for breaking usage down by what it was spent on.
+const (
+	featureAnswer       = "answering"
+	featureQueryParsing = "query parsing"
+	featureWebSearch    = "web search"
+	featureIngest       = "ingest"
+)
+
+// Usage counts model calls, their tokens and their estimated cost in US dollars.
+type Usage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Tokens returns the prompt and completion tokens together.
+func (u Usage) Tokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func (u *Usage) add(other Usage) {
+	u.Calls += other.Calls
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.Cost += other.Cost
+}
+
+// UsageStats is a snapshot of usage since the tracker was created.
+type UsageStats struct {
+	Total    Usage            `json:"total"`
+	Sessions map[string]Usage `json:"sessions,omitempty"`
+	Days     map[string]Usage `json:"days"` // Keyed by campus date, e.g. 2024-10-22
+	Features map[string]Usage `json:"features"`
+	Models   map[string]Usage `json:"models"`
+}
+
+// UsageTracker aggregates the token usage and cost of completions and embeddings per
+// session, day, feature and model, and enforces the configured budgets. It is safe for
+// concurrent use.
+type UsageTracker struct {
+	cfg UsageConfig
+
+	mu       sync.Mutex
+	total    Usage
+	sessions map[string]Usage
+	days     map[string]Usage
+	features map[string]Usage
+	models   map[string]Usage
+}
+
+// NewUsageTracker creates a tracker with the given budgets and prices.
+func NewUsageTracker(cfg UsageConfig) *UsageTracker {
+	return &UsageTracker{
+		cfg:      cfg,
+		sessions: make(map[string]Usage),
+		days:     make(map[string]Usage),
+		features: make(map[string]Usage),
+		models:   make(map[string]Usage),
+	}
+}
+
+// Cost estimates what a call to model costs. Models without a price cost nothing.
+func (t *UsageTracker) Cost(model string, promptTokens, completionTokens int) float64 {
+	price := t.cfg.Prices[model]
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+// Record adds one call to the totals for session, feature and the day of now.
+func (t *UsageTracker) Record(session, feature, model string, promptTokens, completionTokens int, now time.Time) {
+	usage := Usage{
+		Calls:            1,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             t.Cost(model, promptTokens, completionTokens),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total.add(usage)
+	addUsage(t.days, usageDay(now), usage)
+	addUsage(t.features, feature, usage)
+	addUsage(t.models, model, usage)
+	if session != "" {
+		addUsage(t.sessions, session, usage)
+	}
+}
+
+// Session returns the usage of one conversation.
+func (t *UsageTracker) Session(session string) Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessions[session]
+}
+
+// ForgetSession drops a finished conversation from the per-session totals. Its usage
+// stays in the other totals.
+func (t *UsageTracker) ForgetSession(session string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, session)
+}
+
+// Stats returns a snapshot of all totals.
+func (t *UsageTracker) Stats() UsageStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return UsageStats{
+		Total:    t.total,
+		Sessions: copyUsage(t.sessions),
+		Days:     copyUsage(t.days),
+		Features: copyUsage(t.features),
+		Models:   copyUsage(t.models),
+	}
+}
+
+// Model returns the chat model to use for the next completion in session. Within
+// budget that is model; over budget it is the downgrade model, or ErrBudgetExceeded if
+// none is configured.
+func (t *UsageTracker) Model(session, model string, now time.Time) (string, error) {
+	reason := t.overBudget(session, now)
+	if reason == "" {
+		return model, nil
+	}
+	if t.cfg.DowngradeModel == "" {
+		return "", fmt.Errorf("%w: %s", ErrBudgetExceeded, reason)
+	}
+	if model != t.cfg.DowngradeModel {
+		slog.Warn("Over budget, downgrading model", "model", model, "downgrade", t.cfg.DowngradeModel, "reason", reason)
+	}
+	return t.cfg.DowngradeModel, nil
+}
+
+// overBudget describes the budget that session has exceeded, or returns "".
+func (t *UsageTracker) overBudget(session string, now time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit := t.cfg.SessionTokens; limit > 0 && session != "" && t.sessions[session].Tokens() >= limit {
+		return fmt.Sprintf("this conversation has used %d of its %d tokens", t.sessions[session].Tokens(), limit)
+	}
+	if limit := t.cfg.DailyCost; limit > 0 && t.days[usageDay(now)].Cost >= limit {
+		return fmt.Sprintf("today's usage has cost $%.2f of the $%.2f daily budget", t.days[usageDay(now)].Cost, limit)
+	}
+	return ""
+}
+
+// usageDay is the campus date of now.
+func usageDay(now time.Time) string {
+	return now.In(campusLocation).Format(time.DateOnly)
+}
+
+func addUsage(totals map[string]Usage, key string, usage Usage) {
+	total := totals[key]
+	total.add(usage)
+	totals[key] = total
+}
+
+func copyUsage(totals map[string]Usage) map[string]Usage {
+	copied := make(map[string]Usage, len(totals))
+	for key, usage := range totals {
+		copied[key] = usage
+	}
+	return copied
+}
+
+// usageScope says where model calls made under a context are accounted.
+type usageScope struct {
+	tracker *UsageTracker
+	clock   Clock
+	session string
+	feature string
+}
+
+// usageScopeKey carries a usageScope in a context.
+type usageScopeKey struct{}
+
+// WithUsage returns a context under which model calls are recorded in tracker for the
+// given session and feature.
+func WithUsage(ctx context.Context, tracker *UsageTracker, clock Clock, session, feature string) context.Context {
+	if tracker == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, usageScopeKey{}, usageScope{tracker: tracker, clock: clock, session: session, feature: feature})
+}
+
+// withUsageFeature returns a context under which model calls count towards feature
+// instead, keeping the session and tracker of ctx.
+func withUsageFeature(ctx context.Context, feature string) context.Context {
+	scope, ok := ctx.Value(usageScopeKey{}).(usageScope)
+	if !ok {
+		return ctx
+	}
+	scope.feature = feature
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// recordUsage records a model call in the tracker of ctx, if any.
+func recordUsage(ctx context.Context, model string, promptTokens, completionTokens int) {
+	scope, ok := ctx.Value(usageScopeKey{}).(usageScope)
+	if !ok {
+		return
+	}
+	scope.tracker.Record(scope.session, scope.feature, model, promptTokens, completionTokens, scope.clock.Now())
+}
+
+// usageModel returns the chat model to use for the next completion under ctx: model
+// within budget, or as the tracker of ctx decides once the session or day is over budget.
+func usageModel(ctx context.Context, model string) (string, error) {
+	scope, ok := ctx.Value(usageScopeKey{}).(usageScope)
+	if !ok {
+		return model, nil
+	}
+	return scope.tracker.Model(scope.session, model, scope.clock.Now())
+}
+
+// recordCompletionUsage records the usage reported for a chat completion.
+func recordCompletionUsage(ctx context.Context, model string, usage openai.Usage) {
+	recordUsage(ctx, model, usage.PromptTokens, usage.CompletionTokens)
+}
+
+// estimateTokens approximates how many tokens text takes, for calls that don't report
+// usage. English text averages about four characters per token.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// writeUsage prints usage for the REPL's /stats command: the conversation, today, and
+// the breakdown by feature and model.
+func writeUsage(w io.Writer, stats UsageStats, session string, now time.Time) {
+	line := func(label string, usage Usage) {
+		fmt.Fprintf(w, "  %-16s %4d calls  %8d tokens (%d prompt, %d completion)  $%.4f\n",
+			label, usage.Calls, usage.Tokens(), usage.PromptTokens, usage.CompletionTokens, usage.Cost)
+	}
+	fmt.Fprintln(w, "Usage:")
+	line("This session", stats.Sessions[session])
+	line("Today", stats.Days[usageDay(now)])
+	line("Total", stats.Total)
+	if len(stats.Features) > 0 {
+		fmt.Fprintln(w, "By feature:")
+		for _, feature := range sortedKeys(stats.Features) {
+			line(feature, stats.Features[feature])
+		}
+	}
+	if len(stats.Models) > 0 {
+		fmt.Fprintln(w, "By model:")
+		for _, model := range sortedKeys(stats.Models) {
+			line(model, stats.Models[model])
+		}
+	}
+}
+
+// meteredEmbeddingFunction records the estimated usage of the embeddings it computes.
+// OpenAI reports embedding usage, but the chroma client discards it, so tokens are
+// estimated from the text. It sits beneath the embedding cache, so cached texts cost
+// nothing.
+type meteredEmbeddingFunction struct {
+	inner types.EmbeddingFunction
+	model string
+}
+
+// EmbedDocuments embeds texts and records their usage.
+func (e *meteredEmbeddingFunction) EmbedDocuments(ctx context.Context, texts []string) ([]*types.Embedding, error) {
+	embeddings, err := e.inner.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	tokens := 0
+	for _, text := range texts {
+		tokens += estimateTokens(text)
+	}
+	recordUsage(ctx, e.model, tokens, 0)
+	return embeddings, nil
+}
+
+// EmbedQuery embeds a single text and records its usage.
+func (e *meteredEmbeddingFunction) EmbedQuery(ctx context.Context, text string) (*types.Embedding, error) {
+	embeddings, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedRecords embeds the documents of records that have no embedding yet.
+func (e *meteredEmbeddingFunction) EmbedRecords(ctx context.Context, records []*types.Record, force bool) error {
+	return types.EmbedRecordsDefaultImpl(e, ctx, records, force)
+}
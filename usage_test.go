@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// meteredLLM is a stand-in model that reports 100 prompt and 20 completion tokens per
+// completion and records the model each request asked for.
+func meteredLLM(t *testing.T, models *[]string) *LLMClient {
+	var mu sync.Mutex
+	return newStandInLLM(t, func(w http.ResponseWriter, r *http.Request) {
+		req, err := decodeCompletionRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		*models = append(*models, req.Model)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Philip Peterson teaches it."},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+		})
+	})
+}
+
+func TestUsageAccounting(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	var models []string
+	chatbot := NewChatBot(meteredLLM(t, &models), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetClock(fixedClock(now))
+	sessions := NewSessionManager(chatbot, time.Hour)
+	ctx := context.Background()
+
+	alice, bob := startSession(t, sessions), startSession(t, sessions)
+	for _, id := range []string{alice, alice, bob} {
+		if _, _, err := sessions.Answer(ctx, id, "Who teaches CS 110?"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := chatbot.llmClient.ChatCompletion(WithUsage(ctx, chatbot.Usage(), fixedClock(now), bob, featureAnswer), "CS 110 instructor", "Extract the course."); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := chatbot.Usage().Stats()
+	if usage := stats.Sessions[alice]; usage.Calls != 2 || usage.Tokens() != 240 {
+		t.Errorf("Expected 2 calls and 240 tokens for alice, got %+v", usage)
+	}
+	if day := stats.Days["2024-10-22"]; day.Calls != 4 || day.PromptTokens != 400 || day.CompletionTokens != 80 {
+		t.Errorf("Expected the whole day's usage, got %+v", day)
+	}
+	if stats.Features[featureAnswer].Calls != 3 || stats.Features[featureQueryParsing].Calls != 1 {
+		t.Errorf("Unexpected usage by feature: %+v", stats.Features)
+	}
+	// gpt-4o-mini: 400 prompt tokens at $0.15 and 80 completion tokens at $0.60 per million
+	if want := (400*0.15 + 80*0.60) / 1e6; math.Abs(stats.Total.Cost-want) > 1e-12 {
+		t.Errorf("Expected a cost of %v, got %v", want, stats.Total.Cost)
+	}
+
+	var out strings.Builder
+	writeUsage(&out, stats, alice, now)
+	if !strings.Contains(out.String(), "240 tokens") || !strings.Contains(out.String(), featureQueryParsing) {
+		t.Errorf("Unexpected /stats output:\n%s", out.String())
+	}
+
+	// Deleting a session does not reset its budget
+	sessions.Delete(alice)
+	if chatbot.Usage().Session(alice).Calls != 2 || chatbot.Usage().Stats().Total.Calls != 4 {
+		t.Error("Expected a deleted session to keep its usage")
+	}
+}
+
+func TestUsageBudgets(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	courses := []Course{
+		{Subject: "CS", CourseNumber: "110", CRN: "41001", Title: "Introduction to Computer Science", InstructorFirstName: "Philip", InstructorLastName: "Peterson"},
+	}
+	var models []string
+	chatbot := NewChatBot(meteredLLM(t, &models), &MetadataExtractor{courses: courses}, nil, nil, nil)
+	chatbot.SetClock(fixedClock(now))
+	sessions := NewSessionManager(chatbot, time.Hour)
+	ctx := context.Background()
+
+	cfg := DefaultConfig().Usage
+	cfg.SessionTokens = 200
+	cfg.DowngradeModel = openai.GPT3Dot5Turbo
+	chatbot.SetUsageTracker(NewUsageTracker(cfg))
+	alice := startSession(t, sessions)
+	for i := 0; i < 3; i++ {
+		if _, _, err := sessions.Answer(ctx, alice, "Who teaches CS 110?"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := sessions.Answer(ctx, "", "Who teaches CS 110?"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{openai.GPT4oMini, openai.GPT4oMini, openai.GPT3Dot5Turbo, openai.GPT4oMini}
+	if strings.Join(models, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected a downgrade once alice's budget ran out, got %v", models)
+	}
+
+	// Without a downgrade model, questions are refused once the daily budget is spent.
+	cfg = DefaultConfig().Usage
+	cfg.DailyCost = 0.00001
+	chatbot.SetUsageTracker(NewUsageTracker(cfg))
+	carol, _, err := sessions.Answer(ctx, "", "Who teaches CS 110?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := sessions.Answer(ctx, "", "Who teaches CS 110?"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	newServer(sessions).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/ask", strings.NewReader(`{"question": "Who teaches CS 110?"}`)))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 over budget, got %d", recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	newServer(sessions).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stats?session="+carol, nil))
+	var stats statsResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&stats); err != nil || stats.Session == nil || stats.Session.Calls != 1 {
+		t.Errorf("Expected carol's usage from /stats, got %+v, %v", stats, err)
+	}
+	// Other users' session IDs are not listed
+	if strings.Contains(recorder.Body.String(), alice) || stats.Sessions != nil {
+		t.Errorf("Expected no per-session usage from /stats, got %s", recorder.Body.String())
+	}
+}
+
+func TestQueryParsingBudget(t *testing.T) {
+	now := time.Date(2024, 10, 22, 14, 0, 0, 0, campusLocation)
+	var models []string
+	llm := meteredLLM(t, &models)
+
+	// Query parsing counts towards the session's budget and is downgraded with answers.
+	cfg := DefaultConfig().Usage
+	cfg.SessionTokens = 100
+	cfg.DowngradeModel = openai.GPT3Dot5Turbo
+	tracker := NewUsageTracker(cfg)
+	ctx := WithUsage(context.Background(), tracker, fixedClock(now), "alice", featureAnswer)
+	for i := 0; i < 2; i++ {
+		if _, err := llm.ChatCompletion(ctx, "Who teaches CS 110?", "Extract the course."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := openai.GPT4oMini + "," + openai.GPT3Dot5Turbo; strings.Join(models, ",") != want {
+		t.Errorf("Expected query parsing to be downgraded over budget, got %v", models)
+	}
+	if usage := tracker.Stats().Models[openai.GPT3Dot5Turbo]; usage.Calls != 1 {
+		t.Errorf("Expected the downgraded call to be recorded under its model, got %+v", usage)
+	}
+
+	// Without a downgrade model, the call is refused before it reaches the model.
+	cfg.DowngradeModel = ""
+	tracker = NewUsageTracker(cfg)
+	tracker.Record("alice", featureQueryParsing, openai.GPT4oMini, 100, 20, now)
+	ctx = WithUsage(context.Background(), tracker, fixedClock(now), "alice", featureAnswer)
+	if _, err := llm.ChatCompletion(ctx, "Who teaches CS 110?", "Extract the course."); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %v", err)
+	}
+	if len(models) != 2 {
+		t.Errorf("Expected no request over budget, got %v", models)
+	}
+}